@@ -5,7 +5,6 @@ import (
 	"github.com/networkteam/slogutils"
 	"github.com/urfave/cli/v2"
 
-	"github.com/esdete2/envelopr/config"
 	"github.com/esdete2/envelopr/handler"
 )
 
@@ -17,29 +16,47 @@ func BuildCmd() *cli.Command {
 			&cli.StringFlag{
 				Name:    "config",
 				Aliases: []string{"c"},
-				Usage:   "Path to config file",
-				Value:   "envelopr.yaml",
+				Usage:   "Path to config file, searched in the current and parent directories by default",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				Usage:   "Config profile to apply, e.g. staging",
+				EnvVars: []string{"ENVELOPR_PROFILE"},
+			},
+			&cli.StringFlag{
+				Name:    "workspace",
+				Aliases: []string{"w"},
+				Usage:   "Path to a workspace file listing several project configs",
 			},
 		},
 		Action: func(c *cli.Context) error {
 			logger := slogutils.FromContext(c.Context)
 
-			// Load configuration
-			cfg, err := config.LoadConfig(c.String("config"))
+			projects, err := loadProjects(c)
 			if err != nil {
-				return errors.Wrap(err, "loading config")
+				return err
 			}
 
-			// Create processor
-			proc, err := handler.NewProcessor(cfg)
-			if err != nil {
-				return errors.Wrap(err, "creating processor")
-			}
+			for _, project := range projects {
+				// Create processor
+				proc, err := handler.NewProcessor(project.Config)
+				if err != nil {
+					return errors.Wrap(err, "creating processor")
+				}
 
-			// Build
-			err = proc.Process()
-			if err != nil {
-				return errors.Wrap(err, "processing documents")
+				// Build
+				err = proc.Process()
+				if err != nil {
+					if project.Name != "" {
+						return errors.Wrapf(err, "processing documents of project %s", project.Name)
+					}
+					return errors.Wrap(err, "processing documents")
+				}
+
+				if project.Name != "" {
+					logger.Info("Project processed successfully", "project", project.Name)
+				}
 			}
 
 			logger.Info("Documents processed successfully")
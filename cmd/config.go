@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/friendsofgo/errors"
+	"github.com/networkteam/slogutils"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/urfave/cli/v2"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+func ConfigCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "Inspect, validate and migrate the config file",
+		Subcommands: []*cli.Command{
+			configValidateCmd(),
+			configSchemaCmd(),
+			configPrintCmd(),
+			configMigrateCmd(),
+		},
+	}
+}
+
+func configValidateCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "validate",
+		Usage: "Validate the config file and the configured paths",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "Path to config file, searched in the current and parent directories by default",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				Usage:   "Config profile to apply, e.g. staging",
+				EnvVars: []string{"ENVELOPR_PROFILE"},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			logger := slogutils.FromContext(c.Context)
+
+			path, err := configPath(c)
+			if err != nil {
+				return err
+			}
+
+			err = config.ValidateConfig(path, config.WithProfile(c.String("profile")))
+
+			var validationErrs config.ValidationErrors
+			if errors.As(err, &validationErrs) {
+				for _, validationErr := range validationErrs {
+					logger.Error(validationErr.Message, "position", validationErr.Position.String(), "key", validationErr.Key)
+				}
+				return errors.Errorf("config has %d error(s)", len(validationErrs))
+			}
+			if err != nil {
+				return errors.Wrap(err, "validating config")
+			}
+
+			logger.Info("Config is valid", "path", path)
+
+			return nil
+		},
+	}
+}
+
+func configSchemaCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "schema",
+		Usage: "Print the JSON Schema of the config file",
+		Action: func(_ *cli.Context) error {
+			schema, err := config.SchemaJSON()
+			if err != nil {
+				return errors.Wrap(err, "generating schema")
+			}
+
+			fmt.Print(string(schema)) //nolint:forbidigo
+			return nil
+		},
+	}
+}
+
+func configPrintCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "print",
+		Usage: "Print the fully resolved config, annotated with the file of each value",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "Path to config file, searched in the current and parent directories by default",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				Usage:   "Config profile to apply, e.g. staging",
+				EnvVars: []string{"ENVELOPR_PROFILE"},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			path, err := configPath(c)
+			if err != nil {
+				return err
+			}
+
+			err = config.PrintConfig(os.Stdout, path, config.WithProfile(c.String("profile")))
+			if err != nil {
+				return errors.Wrap(err, "printing config")
+			}
+
+			return nil
+		},
+	}
+}
+
+func configMigrateCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "Update the config file to the current format, keeping comments",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "Path to config file, searched in the current and parent directories by default",
+			},
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "Write the migrated config without asking",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only show the changes",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			logger := slogutils.FromContext(c.Context)
+
+			path, err := configPath(c)
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+				return errors.Errorf("migrating %s configs is not supported, only YAML configs can be migrated", ext)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return errors.Wrap(err, "reading config file")
+			}
+
+			migrated, applied, err := config.Migrate(data)
+			if err != nil {
+				return errors.Wrapf(err, "migrating %s", path)
+			}
+			if len(applied) == 0 {
+				logger.Info("Config is up to date", "path", path, "version", config.CurrentVersion)
+				return nil
+			}
+
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(string(data)),
+				B:        difflib.SplitLines(string(migrated)),
+				FromFile: path,
+				ToFile:   path + " (migrated)",
+				Context:  3,
+			})
+			if err != nil {
+				return errors.Wrap(err, "creating diff")
+			}
+			for _, description := range applied {
+				fmt.Println("# " + description) //nolint:forbidigo
+			}
+			fmt.Print(diff) //nolint:forbidigo
+
+			if c.Bool("dry-run") {
+				return nil
+			}
+
+			if !c.Bool("yes") {
+				write := false
+				err := survey.AskOne(&survey.Confirm{
+					Message: fmt.Sprintf("Write the migrated config to %s?", path),
+				}, &write)
+				if err != nil {
+					return errors.Wrap(err, "asking for confirmation")
+				}
+				if !write {
+					return nil
+				}
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				return errors.Wrap(err, "reading config file")
+			}
+			if err := os.WriteFile(path, migrated, info.Mode().Perm()); err != nil {
+				return errors.Wrap(err, "writing config file")
+			}
+
+			logger.Info("Migrated config", "path", path, "version", config.CurrentVersion)
+
+			return nil
+		},
+	}
+}
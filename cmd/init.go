@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/friendsofgo/errors"
@@ -97,7 +98,8 @@ func InitCmd() *cli.Command {
 			}
 			logger.Info("Created config file", "path", answers.ConfigPath)
 
-			// Create directories
+			// Create directories, paths in the config are relative to the config file
+			configDir := filepath.Dir(answers.ConfigPath)
 			dirs := []struct {
 				path string
 				name string
@@ -108,10 +110,14 @@ func InitCmd() *cli.Command {
 			}
 
 			for _, dir := range dirs {
-				if err := os.MkdirAll(dir.path, 0755); err != nil {
+				path := dir.path
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(configDir, path)
+				}
+				if err := os.MkdirAll(path, 0755); err != nil {
 					return errors.Wrapf(err, "creating %s directory", dir.name)
 				}
-				logger.Info("Created directory", "path", dir.path)
+				logger.Info("Created directory", "path", path)
 			}
 
 			return nil
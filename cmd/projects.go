@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/friendsofgo/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+// loadProjects loads the projects of the workspace given by --workspace, or the
+// single project given by --config.
+func loadProjects(c *cli.Context) ([]config.Project, error) {
+	opts := []config.Option{
+		config.WithProfile(c.String("profile")),
+	}
+
+	if workspace := c.String("workspace"); workspace != "" {
+		projects, err := config.LoadWorkspace(workspace, opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading workspace")
+		}
+		return projects, nil
+	}
+
+	path, err := configPath(c)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadConfig(path, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading config")
+	}
+
+	return []config.Project{{Config: cfg}}, nil
+}
+
+// configPath returns the path given by --config or searches the current and
+// parent directories for a config file.
+func configPath(c *cli.Context) (string, error) {
+	if path := c.String("config"); path != "" {
+		return path, nil
+	}
+
+	path, err := config.FindConfig(".")
+	if err != nil {
+		return "", errors.Wrap(err, "finding config")
+	}
+
+	// Keep paths relative to the working directory if possible
+	if cwd, err := os.Getwd(); err == nil {
+		if relPath, err := filepath.Rel(cwd, path); err == nil {
+			return relPath, nil
+		}
+	}
+	return path, nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/friendsofgo/errors"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/esdete2/envelopr/config"
+	"github.com/esdete2/envelopr/handler"
+)
+
+func VarsCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "vars",
+		Usage:     "Print the effective template variables of a document",
+		ArgsUsage: "<document>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "Path to config file, searched in the current and parent directories by default",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				Usage:   "Config profile to apply, e.g. staging",
+				EnvVars: []string{"ENVELOPR_PROFILE"},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return errors.New("expected exactly one document name")
+			}
+
+			path, err := configPath(c)
+			if err != nil {
+				return err
+			}
+
+			// Load configuration
+			cfg, err := config.LoadConfig(path, config.WithProfile(c.String("profile")))
+			if err != nil {
+				return errors.Wrap(err, "loading config")
+			}
+
+			// Create processor
+			proc, err := handler.NewProcessor(cfg)
+			if err != nil {
+				return errors.Wrap(err, "creating processor")
+			}
+
+			vars, err := proc.Variables(c.Args().First())
+			if err != nil {
+				return errors.Wrap(err, "resolving variables")
+			}
+
+			encoder := yaml.NewEncoder(os.Stdout)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(vars); err != nil {
+				return errors.Wrap(err, "encoding variables")
+			}
+
+			return encoder.Close()
+		},
+	}
+}
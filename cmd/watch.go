@@ -10,7 +10,6 @@ import (
 	"github.com/friendsofgo/errors"
 	"github.com/urfave/cli/v2"
 
-	"github.com/esdete2/envelopr/config"
 	"github.com/esdete2/envelopr/handler"
 	"github.com/esdete2/envelopr/web"
 )
@@ -23,8 +22,18 @@ func WatchCmd() *cli.Command {
 			&cli.StringFlag{
 				Name:    "config",
 				Aliases: []string{"c"},
-				Usage:   "Path to config file",
-				Value:   "envelopr.yaml",
+				Usage:   "Path to config file, searched in the current and parent directories by default",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				Usage:   "Config profile to apply, e.g. staging",
+				EnvVars: []string{"ENVELOPR_PROFILE"},
+			},
+			&cli.StringFlag{
+				Name:    "workspace",
+				Aliases: []string{"w"},
+				Usage:   "Path to a workspace file listing several project configs",
 			},
 			&cli.StringFlag{
 				Name:  "host",
@@ -38,37 +47,59 @@ func WatchCmd() *cli.Command {
 			},
 		},
 		Action: func(c *cli.Context) error {
-			// Load configuration
-			cfg, err := config.LoadConfig(c.String("config"))
+			projects, err := loadProjects(c)
 			if err != nil {
-				return errors.Wrap(err, "loading config")
+				return err
+			}
+
+			serverProjects := make([]web.ServerProject, 0, len(projects))
+			for _, project := range projects {
+				serverProjects = append(serverProjects, web.ServerProject{
+					Name:       project.Name,
+					Output:     project.Config.Paths.Output,
+					Extensions: project.Config.OutputExtensions(),
+				})
 			}
 
 			// Initialize web server
 			srv := web.NewServer(&web.ServerOptions{
-				Output: cfg.Paths.Output,
+				Projects: serverProjects,
 			})
 
-			// Create processor
-			proc, err := handler.NewProcessor(cfg)
-			if err != nil {
-				return errors.Wrap(err, "creating processor")
+			watchers := make([]*handler.Watcher, 0, len(projects))
+			stopWatchers := func() {
+				for _, watcher := range watchers {
+					watcher.Stop()
+				}
 			}
 
-			// Initial build
-			err = proc.Process()
-			if err != nil {
-				return errors.Wrap(err, "processing documents")
-			}
+			for _, project := range projects {
+				// Create processor
+				proc, err := handler.NewProcessor(project.Config)
+				if err != nil {
+					stopWatchers()
+					return errors.Wrap(err, "creating processor")
+				}
 
-			// Create and start file watcher
-			watcher, err := handler.NewWatcher(proc, cfg, srv)
-			if err != nil {
-				return errors.Wrap(err, "creating watcher")
-			}
+				// Initial build
+				err = proc.Process()
+				if err != nil {
+					stopWatchers()
+					return errors.Wrap(err, "processing documents")
+				}
+
+				// Create and start file watcher
+				watcher, err := handler.NewWatcher(proc, project.Config, srv)
+				if err != nil {
+					stopWatchers()
+					return errors.Wrap(err, "creating watcher")
+				}
 
-			if err := watcher.Watch(); err != nil {
-				return errors.Wrap(err, "starting watcher")
+				if err := watcher.Watch(); err != nil {
+					stopWatchers()
+					return errors.Wrap(err, "starting watcher")
+				}
+				watchers = append(watchers, watcher)
 			}
 
 			addr := fmt.Sprintf("%s:%s", c.String("host"), c.String("port"))
@@ -88,10 +119,10 @@ func WatchCmd() *cli.Command {
 			select {
 			case <-quit:
 				slog.Info("Shutting down...")
-				watcher.Stop()
+				stopWatchers()
 				return nil
 			case err := <-serverErr:
-				watcher.Stop()
+				stopWatchers()
 				return errors.Wrap(err, "server error")
 			}
 		},
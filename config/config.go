@@ -1,7 +1,12 @@
 package config
 
 import (
+	"log/slog"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/friendsofgo/errors"
 	"gopkg.in/yaml.v3"
@@ -9,8 +14,32 @@ import (
 
 type Paths struct {
 	Documents string `yaml:"documents"`
-	Partials  string `yaml:"partials"`
-	Output    string `yaml:"output"`
+	// Partials are the partial directories, earlier directories take precedence
+	Partials PartialDirs `yaml:"partials"`
+	Output   string      `yaml:"output"`
+	// OutputFile is the path pattern of output files relative to Output, see
+	// OutputPlaceholders
+	OutputFile string `yaml:"outputFile"`
+	// Assets is the directory of images generated by templates, defaults to
+	// the assets directory in Output
+	Assets string `yaml:"assets"`
+	// AssetsURL is the prefix of asset files in the output HTML, defaults to
+	// the path of Assets relative to each output file
+	AssetsURL string `yaml:"assetsUrl"`
+	// Styles is the directory of CSS files included by templates, defaults to
+	// the styles directory next to the config file
+	Styles string `yaml:"styles"`
+}
+
+// OutputConfig is a named output variant. Every document is written once for
+// each variant.
+type OutputConfig struct {
+	// File is the path pattern of the variant, defaults to paths.outputFile
+	File string `yaml:"file"`
+	// MJML overrides the MJML options of the documents for this variant
+	MJML MJMLOverride `yaml:"mjml"`
+	// PostProcess lists the PostProcessSteps applied to the compiled HTML
+	PostProcess []string `yaml:"postProcess"`
 }
 
 type MJMLConfig struct {
@@ -19,41 +48,460 @@ type MJMLConfig struct {
 	Beautify        bool              `yaml:"beautify"`
 	Minify          bool              `yaml:"minify"`
 	Fonts           map[string]string `yaml:"fonts"`
+	// Documents overrides options by document name, directory or glob pattern
+	Documents map[string]MJMLOverride `yaml:"documents"`
+	// Head lists the fragments added to the mj-head of every MJML document
+	Head []HeadFragment `yaml:"head"`
+}
+
+// HeadFragment is MJML added to the mj-head of the documents, set exactly one
+// of MJML, Partial and CSS.
+type HeadFragment struct {
+	// MJML is added as it is, it may use template expressions
+	MJML string `yaml:"mjml"`
+	// Partial is the name of a partial rendered with the data of the document
+	Partial string `yaml:"partial"`
+	// CSS is a stylesheet added as mj-style, relative to the config file
+	CSS string `yaml:"css"`
+	// Inline adds the CSS with inline="inline", so that MJML moves it into the
+	// style attributes of the elements
+	Inline bool `yaml:"inline"`
+}
+
+// MJMLOverride changes the MJML options of some documents. Unset options keep
+// the value of the less specific rules.
+type MJMLOverride struct {
+	ValidationLevel string            `yaml:"validationLevel"`
+	KeepComments    *bool             `yaml:"keepComments"`
+	Beautify        *bool             `yaml:"beautify"`
+	Minify          *bool             `yaml:"minify"`
+	Fonts           map[string]string `yaml:"fonts"`
 }
 
 type TemplateConfig struct {
+	Locale    string         `yaml:"locale"`
 	Variables map[string]any `yaml:"variables"`
 	Documents map[string]any `yaml:"documents"`
+	// Decimals keeps float literals of variables as Decimal with their scale
+	Decimals bool `yaml:"decimals"`
+	// Timezone of formatted dates (IANA name), a "timezone" variable overrides it per document
+	Timezone string `yaml:"timezone"`
+	// Event is the variable holding the calendar event of a document, no
+	// calendar files are written if empty
+	Event string `yaml:"event"`
+	// Duplicates is the handling of templates defined in more than one file
+	Duplicates string `yaml:"duplicates"`
+	// Escape is the escaping of values written by templates
+	Escape string `yaml:"escape"`
+	// Limits restrict the resources used to render a document
+	Limits LimitsConfig `yaml:"limits"`
+	// Restricted disables template functions and variables giving access to the
+	// environment, files or code outside of the template
+	Restricted bool `yaml:"restricted"`
+}
+
+type LimitsConfig struct {
+	// Timeout is the maximum duration of rendering a document, e.g. 5s
+	Timeout string `yaml:"timeout"`
+	// MaxOutputSize is the maximum size of a rendered document in bytes
+	MaxOutputSize int `yaml:"maxOutputSize"`
+	// MaxDepth is the maximum nesting depth of template calls
+	MaxDepth int `yaml:"maxDepth"`
+}
+
+// TimeoutDuration returns the parsed timeout, zero if no timeout is set.
+func (c LimitsConfig) TimeoutDuration() time.Duration {
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return 0
+	}
+	return timeout
+}
+
+type BuildConfig struct {
+	// Time overrides the build time (RFC 3339) for deterministic builds
+	Time string `yaml:"time"`
+	// Commit overrides the git commit of the config directory
+	Commit string `yaml:"commit"`
+	// Env lists the environment variables that are exposed to templates
+	Env []string `yaml:"env"`
 }
 
 type Config struct {
+	// Version of the config format, configs without a version are version 1
+	Version  int            `yaml:"version"`
 	Paths    Paths          `yaml:"paths"`
 	MJML     MJMLConfig     `yaml:"mjml"`
 	Template TemplateConfig `yaml:"template"`
+	Build    BuildConfig    `yaml:"build"`
+	// Extensions of documents and partials
+	Extensions ExtensionsConfig `yaml:"extensions"`
+	// Outputs are the output variants by name, a single output is written if empty
+	Outputs map[string]OutputConfig `yaml:"outputs"`
+
+	// Profile is the name of the active profile, empty if none is selected
+	Profile string `yaml:"-"`
+	// Dir is the directory of the config file
+	Dir string `yaml:"-"`
 }
 
-func LoadConfig(path string) (*Config, error) {
-	var config Config
-	yamlData, err := os.ReadFile(path)
+const (
+	// profilesKey is the top-level key holding the inline profile overlays.
+	profilesKey = "profiles"
+	// extendsKey and includeKey list other config files merged below a file.
+	extendsKey = "extends"
+	includeKey = "include"
+	// outputsKey holds the named output variants.
+	outputsKey = "outputs"
+)
+
+var ErrProfileNotFound = errors.New("profile not found")
+var ErrIncludeCycle = errors.New("config include cycle")
+var ErrInvalidInclude = errors.New("invalid include")
+
+type Option func(*loadOptions)
+
+type loadOptions struct {
+	profile   string
+	lookupEnv func(string) (string, bool)
+}
+
+// WithProfile selects a profile that is merged over the base configuration.
+func WithProfile(profile string) Option {
+	return func(o *loadOptions) {
+		o.profile = profile
+	}
+}
+
+// WithLookupEnv replaces the environment lookup used for interpolation.
+func WithLookupEnv(lookupEnv func(string) (string, bool)) Option {
+	return func(o *loadOptions) {
+		o.lookupEnv = lookupEnv
+	}
+}
+
+// LoadConfig loads the config file at path. Environment variables in values are
+// interpolated and the selected profile is deep-merged over the base config.
+// Unknown keys and invalid values are reported as ValidationErrors.
+func LoadConfig(path string, opts ...Option) (*Config, error) {
+	config, v, err := newLoader(opts).load(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "reading config file")
+		return nil, err
+	}
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+
+	return config, nil
+}
+
+type loader struct {
+	options loadOptions
+	// origins maps every loaded node to the file it was read from
+	origins map[*yaml.Node]string
+	// stack holds the files currently being loaded for cycle detection
+	stack []string
+	// root is the merged node tree of the last load
+	root *yaml.Node
+}
+
+func newLoader(opts []Option) *loader {
+	options := loadOptions{
+		lookupEnv: os.LookupEnv,
+	}
+	for _, opt := range opts {
+		opt(&options)
 	}
 
-	err = yaml.Unmarshal(yamlData, &config)
+	return &loader{
+		options: options,
+		origins: make(map[*yaml.Node]string),
+	}
+}
+
+// load reads and decodes the config. Structural errors are returned as error,
+// invalid values are collected in the returned validator.
+func (l *loader) load(path string) (*Config, *validator, error) {
+	root, err := l.loadNode(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "unmarshalling config")
+		return nil, nil, err
+	}
+
+	v := &validator{
+		file:      path,
+		origins:   l.origins,
+		positions: make(map[string]Position),
+	}
+
+	profiles := removeKey(root, profilesKey)
+	if profiles != nil && profiles.ShortTag() != "!!null" {
+		if profiles.Kind != yaml.MappingNode {
+			v.addError(profiles, profilesKey, "expected a mapping, got %s", describeNode(profiles))
+		} else {
+			for i := 0; i+1 < len(profiles.Content); i += 2 {
+				v.checkNode(profiles.Content[i+1], reflect.TypeOf(Config{}), joinKey(profilesKey, profiles.Content[i].Value))
+			}
+		}
+	}
+
+	if profile := l.options.profile; profile != "" {
+		found := false
+
+		// Inline profile section
+		if overlay := mappingValue(profiles, profile); overlay != nil {
+			root = mergeNodes(root, overlay)
+			found = true
+		}
+
+		// Profile file next to the config, e.g. envelopr.staging.yaml
+		profilePath := ProfilePath(path, profile)
+		if _, err := os.Stat(profilePath); err == nil {
+			overlay, err := l.loadNode(profilePath)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "loading profile %s", profile)
+			}
+			root = mergeNodes(root, overlay)
+			found = true
+		}
+
+		if !found {
+			return nil, nil, errors.Wrapf(ErrProfileNotFound, "profile: %s", profile)
+		}
+	}
+
+	l.root = root
+
+	// Check the structure first, decoding would stop at the first error
+	v.checkNode(root, reflect.TypeOf(Config{}), "")
+	if len(v.errs) > 0 {
+		return nil, nil, v.errs
+	}
+
+	var config Config
+	if err := root.Decode(&config); err != nil {
+		return nil, nil, errors.Wrapf(err, "unmarshalling config %s", path)
+	}
+	config.Profile = l.options.profile
+	config.Dir = filepath.Dir(path)
+	if config.Template.Decimals {
+		if err := decodeVariables(root, &config.Template); err != nil {
+			return nil, nil, errors.Wrapf(err, "unmarshalling config %s", path)
+		}
 	}
 
-	// Set default values
+	v.checkValues(&config)
+
+	if config.Version == 0 {
+		config.Version = legacyVersion
+	}
+	if config.Version < CurrentVersion {
+		slog.Warn("Config uses an outdated format, run \"envelopr config migrate\" to update it",
+			"path", path, "version", config.Version, "current", CurrentVersion)
+	}
+
+	// Relative paths are resolved from the file that sets them
+	resolve := func(key string, p *string) {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(filepath.Dir(v.positionOf(key).File), *p)
+		}
+	}
+	resolve("paths.documents", &config.Paths.Documents)
+	resolve("paths.output", &config.Paths.Output)
+	resolve("paths.assets", &config.Paths.Assets)
+	resolve("paths.styles", &config.Paths.Styles)
+	for i := range config.Paths.Partials {
+		resolve("paths.partials", &config.Paths.Partials[i].Path)
+	}
+	for i := range config.MJML.Head {
+		resolve("mjml.head", &config.MJML.Head[i].CSS)
+	}
+
+	// Set default values, relative to the config file
 	if config.Paths.Documents == "" {
-		config.Paths.Documents = "documents"
+		config.Paths.Documents = filepath.Join(filepath.Dir(path), "documents")
 	}
 	if config.Paths.Output == "" {
-		config.Paths.Output = "output"
+		config.Paths.Output = filepath.Join(filepath.Dir(path), "output")
+	}
+	if config.Paths.OutputFile == "" {
+		config.Paths.OutputFile = DefaultOutputFile
+	}
+	if config.Paths.Assets == "" {
+		config.Paths.Assets = filepath.Join(config.Paths.Output, DefaultAssetsDir)
+	}
+	if config.Paths.Styles == "" {
+		config.Paths.Styles = filepath.Join(filepath.Dir(path), "styles")
 	}
 	if config.MJML.ValidationLevel == "" {
 		config.MJML.ValidationLevel = "soft"
 	}
+	if config.Template.Duplicates == "" {
+		config.Template.Duplicates = DuplicatesWarn
+	}
+	if config.Template.Escape == "" {
+		config.Template.Escape = EscapeHTML
+	}
+
+	return &config, v, nil
+}
+
+// ProfilePath returns the path of the profile file for a config file, e.g.
+// envelopr.staging.yaml for envelopr.yaml and the profile "staging".
+func ProfilePath(path, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// loadNode reads a YAML file and returns its interpolated root mapping node.
+// Files listed in extends and include are loaded recursively and the file is
+// merged over them.
+func (l *loader) loadNode(path string) (*yaml.Node, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving config path")
+	}
+	for i, loading := range l.stack {
+		if loading == absPath {
+			chain := append(append([]string{}, l.stack[i:]...), absPath)
+			return nil, errors.Wrapf(ErrIncludeCycle, "%s", strings.Join(chain, " -> "))
+		}
+	}
+	l.stack = append(l.stack, absPath)
+	defer func() {
+		l.stack = l.stack[:len(l.stack)-1]
+	}()
+
+	root, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty files have no content
+	if root == nil {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+
+	// The JSON Schema reference of editors is not part of the config
+	removeKey(root, "$schema")
+
+	if err := interpolateNode(root, l.options.lookupEnv); err != nil {
+		return nil, errors.Wrapf(err, "interpolating %s", path)
+	}
+	recordOrigin(l.origins, root, path)
 
-	return &config, nil
+	if root.Kind != yaml.MappingNode {
+		return root, nil
+	}
+
+	var base *yaml.Node
+	for _, key := range []string{extendsKey, includeKey} {
+		includes, err := includePaths(removeKey(root, key))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s in %s", key, path)
+		}
+		for _, include := range includes {
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(path), include)
+			}
+			node, err := l.loadNode(include)
+			if err != nil {
+				return nil, errors.Wrapf(err, "loading %s", include)
+			}
+			if base == nil {
+				base = node
+			} else {
+				base = mergeNodes(base, node)
+			}
+		}
+	}
+
+	if base != nil {
+		return mergeNodes(base, root), nil
+	}
+	return root, nil
+}
+
+// includePaths reads the value of extends or include, a single path or a list.
+func includePaths(node *yaml.Node) ([]string, error) {
+	if node == nil || node.ShortTag() == "!!null" {
+		return nil, nil
+	}
+
+	switch node.Kind { //nolint:exhaustive
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		paths := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, errors.Wrapf(ErrInvalidInclude, "line %d: expected a path", item.Line)
+			}
+			paths = append(paths, item.Value)
+		}
+		return paths, nil
+	default:
+		return nil, errors.Wrapf(ErrInvalidInclude, "line %d: expected a path or a list of paths", node.Line)
+	}
+}
+
+// recordOrigin maps node and all its descendants to the file at path.
+func recordOrigin(origins map[*yaml.Node]string, node *yaml.Node, path string) {
+	origins[node] = path
+	for _, child := range node.Content {
+		recordOrigin(origins, child, path)
+	}
+}
+
+// mergeNodes deep-merges the overlay mapping over the base mapping. Values that
+// are not mappings on both sides are replaced by the overlay.
+func mergeNodes(base, overlay *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+
+		replaced := false
+		for j := 0; j+1 < len(base.Content); j += 2 {
+			if base.Content[j].Value == key.Value {
+				base.Content[j+1] = mergeNodes(base.Content[j+1], value)
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			base.Content = append(base.Content, key, value)
+		}
+	}
+
+	return base
+}
+
+// mappingValue returns the value node of key in a mapping node or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// removeKey removes key from a mapping node and returns its value or nil.
+func removeKey(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			value := node.Content[i+1]
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return value
+		}
+	}
+	return nil
 }
@@ -1,6 +1,8 @@
 package config_test
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -54,10 +56,10 @@ template:
 		cfg, err := config.LoadConfig(configPath)
 		r.NoError(err)
 
-		// Verify paths
-		r.Equal("templates", cfg.Paths.Documents)
-		r.Equal("partials", cfg.Paths.Partials)
-		r.Equal("dist", cfg.Paths.Output)
+		// Verify paths, relative to the config file
+		r.Equal(filepath.Join(tmpDir, "templates"), cfg.Paths.Documents)
+		r.Equal(config.PartialDirs{{Path: filepath.Join(tmpDir, "partials")}}, cfg.Paths.Partials)
+		r.Equal(filepath.Join(tmpDir, "dist"), cfg.Paths.Output)
 
 		// Verify MJML config
 		r.Equal("soft", cfg.MJML.ValidationLevel)
@@ -127,14 +129,621 @@ invalid_yaml:
 		cfg, err := config.LoadConfig(configPath)
 		r.NoError(err) // Empty config is valid
 		r.Equal(&config.Config{
+			Version: 1, // Configs without a version use the first format
+			Dir:     tmpDir,
 			Paths: config.Paths{
-				Documents: "documents",
-				Output:    "output",
+				Documents:  filepath.Join(tmpDir, "documents"),
+				Output:     filepath.Join(tmpDir, "output"),
+				OutputFile: config.DefaultOutputFile,
+				Assets:     filepath.Join(tmpDir, "output", "assets"),
+				Styles:     filepath.Join(tmpDir, "styles"),
 			},
 			MJML: config.MJMLConfig{
 				ValidationLevel: "soft", // Default validation level
 			},
-			Template: config.TemplateConfig{},
+			Template: config.TemplateConfig{
+				Duplicates: config.DuplicatesWarn, // Default handling of duplicate templates
+				Escape:     config.EscapeHTML,     // Default escaping
+			},
 		}, cfg)
 	})
 }
+
+func TestLoadConfig_Interpolation(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	r.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	configContent := `
+paths:
+  output: ${OUTPUT_DIR:-dist}
+mjml:
+  minify: ${MINIFY:-false}
+template:
+  variables:
+    baseUrl: ${BASE_URL}/shop
+    price: $$10
+    quoted: "${MINIFY}"
+`
+	configPath := filepath.Join(tmpDir, "envelopr.yaml")
+	r.NoError(os.WriteFile(configPath, []byte(configContent), 0644))
+
+	env := map[string]string{
+		"BASE_URL": "https://example.com",
+		"MINIFY":   "true",
+	}
+	cfg, err := config.LoadConfig(configPath, config.WithLookupEnv(func(name string) (string, bool) {
+		val, ok := env[name]
+		return val, ok
+	}))
+	r.NoError(err)
+
+	r.Equal(filepath.Join(tmpDir, "dist"), cfg.Paths.Output)
+	r.True(cfg.MJML.Minify)
+	r.Equal("https://example.com/shop", cfg.Template.Variables["baseUrl"])
+	r.Equal("$10", cfg.Template.Variables["price"])
+	r.Equal("true", cfg.Template.Variables["quoted"])
+}
+
+func TestLoadConfig_Decimals(t *testing.T) {
+	content := `template:
+  variables:
+    price: 10.00
+    rate: 1e3
+    count: 3
+    base: &base
+      tax: 0.190
+    items:
+      - 1.50
+      - name
+    merged:
+      <<: *base
+      net: 8.40
+  documents:
+    invoice:
+      total: -0.5
+`
+	writeConfig := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "envelopr.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	t.Run("floats by default", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg, err := config.LoadConfig(writeConfig(t, content))
+		r.NoError(err)
+		r.InDelta(10.0, cfg.Template.Variables["price"], 0)
+	})
+
+	t.Run("decimals keep their scale", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg, err := config.LoadConfig(writeConfig(t, content+"  decimals: true\n"))
+		r.NoError(err)
+
+		vars := cfg.Template.Variables
+		r.Equal("10.00", fmt.Sprint(vars["price"]))
+		r.IsType(config.Decimal{}, vars["price"])
+		r.InDelta(1000.0, vars["rate"], 0)
+		r.Equal(3, vars["count"])
+		r.Equal("1.50", fmt.Sprint(vars["items"].([]any)[0]))
+		r.Equal("name", vars["items"].([]any)[1])
+		merged := vars["merged"].(map[string]any)
+		r.Equal("0.190", fmt.Sprint(merged["tax"]))
+		r.Equal("8.40", fmt.Sprint(merged["net"]))
+		r.Equal("-0.5", fmt.Sprint(cfg.Template.Documents["invoice"].(map[string]any)["total"]))
+	})
+}
+
+func TestDecimal_Round(t *testing.T) {
+	tests := []struct {
+		value    string
+		scale    int
+		expected string
+	}{
+		{"10", 2, "10.00"},
+		{"10.005", 2, "10.01"},
+		{"-10.005", 2, "-10.01"},
+		{"9.995", 2, "10.00"},
+		{"0.004", 2, "0.00"},
+		{"-0.004", 2, "0.00"},
+		{"0.0005", 0, "0"},
+		{"1234.5", 0, "1235"},
+		{"+.5", 1, "0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			r := require.New(t)
+
+			d, err := config.ParseDecimal(tt.value)
+			r.NoError(err)
+			r.Equal(tt.expected, d.Round(tt.scale).String())
+		})
+	}
+
+	_, err := config.ParseDecimal("1e3")
+	require.ErrorIs(t, err, config.ErrInvalidDecimal)
+}
+
+func TestLoadConfig_Profiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	configContent := `
+paths:
+  output: dist
+mjml:
+  minify: false
+template:
+  variables:
+    baseUrl: http://localhost
+    tracking:
+      enabled: false
+      id: none
+profiles:
+  staging:
+    template:
+      variables:
+        baseUrl: https://staging.example.com
+`
+	productionContent := `
+mjml:
+  minify: true
+template:
+  variables:
+    baseUrl: https://example.com
+    tracking:
+      enabled: true
+`
+	configPath := filepath.Join(tmpDir, "envelopr.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "envelopr.production.yaml"), []byte(productionContent), 0644))
+
+	t.Run("no profile", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg, err := config.LoadConfig(configPath)
+		r.NoError(err)
+		r.Empty(cfg.Profile)
+		r.Equal("http://localhost", cfg.Template.Variables["baseUrl"])
+		r.NotContains(cfg.Template.Variables, "profiles")
+	})
+
+	t.Run("inline profile", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg, err := config.LoadConfig(configPath, config.WithProfile("staging"))
+		r.NoError(err)
+		r.Equal("staging", cfg.Profile)
+		r.Equal("https://staging.example.com", cfg.Template.Variables["baseUrl"])
+		r.Equal(filepath.Join(tmpDir, "dist"), cfg.Paths.Output)
+	})
+
+	t.Run("profile file", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg, err := config.LoadConfig(configPath, config.WithProfile("production"))
+		r.NoError(err)
+		r.Equal("production", cfg.Profile)
+		r.True(cfg.MJML.Minify)
+		r.Equal("https://example.com", cfg.Template.Variables["baseUrl"])
+		r.Equal(map[string]any{"enabled": true, "id": "none"}, cfg.Template.Variables["tracking"])
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := config.LoadConfig(configPath, config.WithProfile("missing"))
+		r.ErrorIs(err, config.ErrProfileNotFound)
+	})
+}
+
+func TestLoadConfig_Validation(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	writeConfig := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(tmpDir, "envelopr.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	t.Run("unknown fields", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `mjml:
+  validationlevel: strict
+template:
+  document:
+    welcome: {}
+`)
+		_, err := config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 2)
+
+		r.Equal("mjml.validationlevel", validationErrs[0].Key)
+		r.Equal(config.Position{File: path, Line: 2, Column: 3}, validationErrs[0].Position)
+		r.Contains(validationErrs[0].Message, `did you mean "validationLevel"?`)
+
+		r.Equal("template.document", validationErrs[1].Key)
+		r.Equal(config.Position{File: path, Line: 4, Column: 3}, validationErrs[1].Position)
+	})
+
+	t.Run("invalid types", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `mjml:
+  minify: sometimes
+  fonts: Roboto
+`)
+		_, err := config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 2)
+		r.Equal("mjml.minify", validationErrs[0].Key)
+		r.Equal("mjml.fonts", validationErrs[1].Key)
+	})
+
+	t.Run("invalid validation level", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `mjml:
+  validationLevel: hard
+`)
+		_, err := config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 1)
+		r.Equal(config.Position{File: path, Line: 2, Column: 20}, validationErrs[0].Position)
+		r.EqualError(err, path+`:2:20: mjml.validationLevel: invalid value "hard", expected one of strict, soft, skip`)
+	})
+
+	t.Run("invalid document options", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `mjml:
+  documents:
+    newsletters/*:
+      validationLevel: hard
+      minify: yes please
+`)
+		_, err := config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 1)
+		r.Equal("mjml.documents.newsletters/*.minify", validationErrs[0].Key)
+
+		path = writeConfig(t, `mjml:
+  documents:
+    newsletters/*:
+      validationLevel: hard
+`)
+		_, err = config.LoadConfig(path)
+		r.EqualError(err, path+`:4:24: mjml.documents.newsletters/*.validationLevel: invalid value "hard", expected one of strict, soft, skip`)
+	})
+
+	t.Run("invalid head fragments", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `mjml:
+  head:
+    - css: styles/dark.css
+    - mjml: <mj-attributes />
+      partial: head
+    - partial: head
+      inline: true
+`)
+		_, err := config.LoadConfig(path)
+		r.EqualError(err, path+`:4:7: mjml.head[1]: expected exactly one of mjml, partial and css
+`+path+`:6:7: mjml.head[2]: inline is only supported for css`)
+
+		path = writeConfig(t, `mjml:
+  head:
+    - css: styles/dark.css
+      inline: true
+`)
+		cfg, err := config.LoadConfig(path)
+		r.NoError(err)
+		r.Equal(filepath.Join(tmpDir, "styles", "dark.css"), cfg.MJML.Head[0].CSS)
+	})
+
+	t.Run("invalid duplicates mode", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `template:
+  duplicates: ignore
+`)
+		_, err := config.LoadConfig(path)
+		r.EqualError(err, path+`:2:15: template.duplicates: invalid value "ignore", expected one of warn, error`)
+	})
+
+	t.Run("invalid limits", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `template:
+  limits:
+    timeout: 5
+    maxOutputSize: -1
+`)
+		_, err := config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 2)
+		r.Equal("template.limits.timeout", validationErrs[0].Key)
+		r.Equal("template.limits.maxOutputSize", validationErrs[1].Key)
+	})
+
+	t.Run("invalid outputs", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `paths:
+  outputFile: "{dir}/{title}.html"
+outputs:
+  min:
+    postProcess: [trim, gzip]
+  pretty:
+    file: ../{path}.html
+  plain: {}
+`)
+		_, err := config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 4)
+		r.Equal("paths.outputFile", validationErrs[0].Key)
+		r.Contains(validationErrs[0].Message, "unknown placeholder {title}")
+		r.Equal("outputs.min.postProcess[1]", validationErrs[1].Key)
+		r.Equal("outputs.plain", validationErrs[2].Key)
+		r.Contains(validationErrs[2].Message, `same files as output "min"`)
+		r.Equal("outputs.pretty.file", validationErrs[3].Key)
+		r.Equal(config.Position{File: path, Line: 7, Column: 11}, validationErrs[3].Position)
+	})
+
+	t.Run("invalid extensions", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `extensions:
+  documents: [.mjml, html]
+  html: [.mjml]
+`)
+		_, err := config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 2)
+		r.Equal("extensions.documents[1]", validationErrs[0].Key)
+		r.Equal("extensions.html", validationErrs[1].Key)
+	})
+
+	t.Run("invalid partial directories", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `paths:
+  partials:
+    - partials
+    - path: vendor/brand
+      namespace: ../brand
+    - pth: vendor/other
+`)
+		_, err := config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 3)
+		r.Equal("paths.partials[1].namespace", validationErrs[0].Key)
+		r.Equal(config.Position{File: path, Line: 5, Column: 18}, validationErrs[0].Position)
+		r.Equal("paths.partials[2].pth", validationErrs[1].Key)
+		r.Contains(validationErrs[1].Message, `did you mean "path"?`)
+		r.Equal("paths.partials[2]", validationErrs[2].Key)
+		r.Equal("path is required", validationErrs[2].Message)
+	})
+
+	t.Run("invalid profile", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `profiles:
+  staging:
+    mjml:
+      minfy: true
+`)
+		_, err := config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 1)
+		r.Equal("profiles.staging.mjml.minfy", validationErrs[0].Key)
+	})
+
+	t.Run("missing directories", func(t *testing.T) {
+		r := require.New(t)
+
+		path := writeConfig(t, `paths:
+  documents: `+filepath.Join(tmpDir, "missing")+`
+  output: `+filepath.Join(tmpDir, "envelopr.yaml")+`
+`)
+		err := config.ValidateConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Len(validationErrs, 2)
+		r.Equal("paths.documents", validationErrs[0].Key)
+		r.Equal(2, validationErrs[0].Position.Line)
+		r.Equal("paths.output", validationErrs[1].Key)
+		r.Contains(validationErrs[1].Message, "is not a directory")
+	})
+}
+
+func TestLoadConfig_Includes(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"shared/base.yaml": `
+include: fonts.yaml
+paths:
+  partials:
+    - partials
+    - path: brand
+      namespace: brand
+mjml:
+  validationLevel: strict
+  minify: true
+template:
+  variables:
+    company: ACME
+    support: support@acme.com
+`,
+		"shared/fonts.yaml": `
+mjml:
+  fonts:
+    Roboto: https://fonts.googleapis.com/css?family=Roboto
+`,
+		"project/envelopr.yaml": `
+extends: ../shared/base.yaml
+mjml:
+  minify: false
+template:
+  variables:
+    support: help@acme.com
+`,
+		"cycle/a.yaml": `extends: b.yaml`,
+		"cycle/b.yaml": `extends: [a.yaml]`,
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	t.Run("extends and include", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg, err := config.LoadConfig(filepath.Join(tmpDir, "project/envelopr.yaml"))
+		r.NoError(err)
+		r.Equal("strict", cfg.MJML.ValidationLevel)
+		r.False(cfg.MJML.Minify)
+		r.Equal("https://fonts.googleapis.com/css?family=Roboto", cfg.MJML.Fonts["Roboto"])
+		r.Equal("ACME", cfg.Template.Variables["company"])
+		r.Equal("help@acme.com", cfg.Template.Variables["support"])
+
+		// Partial directories are relative to the file that sets them
+		r.Equal(config.PartialDirs{
+			{Path: filepath.Join(tmpDir, "shared/partials")},
+			{Path: filepath.Join(tmpDir, "shared/brand"), Namespace: "brand"},
+		}, cfg.Paths.Partials)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := config.LoadConfig(filepath.Join(tmpDir, "cycle/a.yaml"))
+		r.ErrorIs(err, config.ErrIncludeCycle)
+	})
+
+	t.Run("print annotates origins", func(t *testing.T) {
+		r := require.New(t)
+
+		var buf bytes.Buffer
+		r.NoError(config.PrintConfig(&buf, filepath.Join(tmpDir, "project/envelopr.yaml")))
+
+		out := buf.String()
+		r.Regexp(`validationLevel: strict # .*shared/base\.yaml`, out)
+		r.Regexp(`minify: false # .*project/envelopr\.yaml`, out)
+		r.Regexp(`Roboto: \S+ # .*shared/fonts\.yaml`, out)
+		r.Regexp(`output: \S+/project/output # default`, out)
+		r.Regexp(`namespace: brand # .*shared/base\.yaml`, out)
+	})
+}
+
+func TestLoadConfig_Formats(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"json/envelopr.json": `{
+  "$schema": "https://example.com/envelopr.schema.json",
+  "paths": {"documents": "templates"},
+  "mjml": {"minify": true, "fonts": {"Roboto": "https://fonts.googleapis.com/css?family=Roboto"}},
+  "template": {"variables": {"company": "ACME", "year": 2024}}
+}`,
+		"toml/envelopr.toml": `
+[paths]
+documents = "templates"
+output = "${OUTPUT:-dist}"
+
+[mjml]
+minify = true
+validationLevel = "strict"
+
+[template.variables]
+company = "ACME"
+year = 2024
+`,
+		"toml/envelopr.production.toml": `
+[template.variables]
+company = "ACME Corp"
+`,
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	t.Run("json", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg, err := config.LoadConfig(filepath.Join(tmpDir, "json/envelopr.json"))
+		r.NoError(err)
+		r.Equal(filepath.Join(tmpDir, "json/templates"), cfg.Paths.Documents)
+		r.True(cfg.MJML.Minify)
+		r.Equal("https://fonts.googleapis.com/css?family=Roboto", cfg.MJML.Fonts["Roboto"])
+		r.Equal("ACME", cfg.Template.Variables["company"])
+		r.Equal(2024, cfg.Template.Variables["year"])
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg, err := config.LoadConfig(filepath.Join(tmpDir, "toml/envelopr.toml"), config.WithProfile("production"))
+		r.NoError(err)
+		r.Equal(filepath.Join(tmpDir, "toml/templates"), cfg.Paths.Documents)
+		r.Equal(filepath.Join(tmpDir, "toml/dist"), cfg.Paths.Output)
+		r.Equal("strict", cfg.MJML.ValidationLevel)
+		r.True(cfg.MJML.Minify)
+		r.Equal("ACME Corp", cfg.Template.Variables["company"])
+		r.Equal(2024, cfg.Template.Variables["year"])
+	})
+
+	t.Run("toml validation errors", func(t *testing.T) {
+		r := require.New(t)
+
+		path := filepath.Join(tmpDir, "invalid/envelopr.toml")
+		r.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		r.NoError(os.WriteFile(path, []byte("[mjml]\nvalidationlevel = \"strict\"\n"), 0644))
+
+		_, err := config.LoadConfig(path)
+		r.Error(err)
+		r.Contains(err.Error(), path+" (TOML positions are unavailable): mjml.validationlevel")
+	})
+
+	t.Run("find config in parent directories", func(t *testing.T) {
+		r := require.New(t)
+
+		nested := filepath.Join(tmpDir, "toml/templates/shop")
+		r.NoError(os.MkdirAll(nested, 0755))
+
+		path, err := config.FindConfig(nested)
+		r.NoError(err)
+		r.Equal(filepath.Join(tmpDir, "toml/envelopr.toml"), path)
+
+		_, err = config.FindConfig(filepath.Join(tmpDir, ".."))
+		r.ErrorIs(err, config.ErrConfigNotFound)
+	})
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/friendsofgo/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidDecimal = errors.New("invalid decimal")
+
+// decimalPattern matches plain decimal literals, exponents, infinity and NaN
+// are kept as floats.
+var decimalPattern = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)$`)
+
+// Decimal is an exact decimal number that keeps the scale of its literal, so
+// that 10.00 is printed as 10.00.
+type Decimal struct {
+	negative bool
+	// digits are the integer and fraction digits without leading zeros
+	digits string
+	// scale is the number of fraction digits
+	scale int
+}
+
+// ParseDecimal parses a decimal literal like 10.00 or -0.5.
+func ParseDecimal(s string) (Decimal, error) {
+	if !decimalPattern.MatchString(s) {
+		return Decimal{}, errors.Wrapf(ErrInvalidDecimal, "%q", s)
+	}
+
+	var d Decimal
+	switch s[0] {
+	case '-':
+		d.negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	integer, fraction, _ := strings.Cut(s, ".")
+	d.scale = len(fraction)
+	d.digits = strings.TrimLeft(integer+fraction, "0")
+	if d.digits == "" {
+		d.negative = false
+	}
+	return d, nil
+}
+
+// Scale returns the number of fraction digits.
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// Negative reports whether d is less than zero.
+func (d Decimal) Negative() bool {
+	return d.negative
+}
+
+// Parts returns the integer and fraction digits of d without sign.
+func (d Decimal) Parts() (string, string) {
+	digits := d.digits
+	if len(digits) <= d.scale {
+		digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+	}
+	return digits[:len(digits)-d.scale], digits[len(digits)-d.scale:]
+}
+
+// String returns d with its scale, e.g. "10.00".
+func (d Decimal) String() string {
+	integer, fraction := d.Parts()
+	s := integer
+	if fraction != "" {
+		s += "." + fraction
+	}
+	if d.negative {
+		s = "-" + s
+	}
+	return s
+}
+
+// Float64 returns the nearest float of d.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Round returns d with scale fraction digits, rounding halves away from zero.
+func (d Decimal) Round(scale int) Decimal {
+	if scale < 0 {
+		scale = 0
+	}
+	if scale >= d.scale {
+		if d.digits != "" {
+			d.digits += strings.Repeat("0", scale-d.scale)
+		}
+		d.scale = scale
+		return d
+	}
+
+	cut := len(d.digits) - (d.scale - scale)
+	if cut < 0 {
+		return Decimal{scale: scale}
+	}
+	digits := []byte(d.digits[:cut])
+	if d.digits[cut] >= '5' {
+		// Add one to the last kept digit and carry
+		i := len(digits) - 1
+		for ; i >= 0 && digits[i] == '9'; i-- {
+			digits[i] = '0'
+		}
+		if i < 0 {
+			digits = append([]byte{'1'}, digits...)
+		} else {
+			digits[i]++
+		}
+	}
+
+	rounded := Decimal{negative: d.negative, digits: strings.TrimLeft(string(digits), "0"), scale: scale}
+	if rounded.digits == "" {
+		rounded.negative = false
+	}
+	return rounded
+}
+
+// MarshalYAML writes d as float literal with its scale.
+func (d Decimal) MarshalYAML() (any, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: d.String()}, nil
+}
+
+// MarshalJSON writes d as number with its scale.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// decodeDecimals decodes a node like yaml.v3 decodes into any, but keeps float
+// literals as Decimal.
+func decodeDecimals(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return decodeDecimals(node.Alias)
+	case yaml.MappingNode:
+		values := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			// Merge keys add the values of other mappings without overriding
+			if key.ShortTag() == "!!merge" {
+				merged, err := decodeDecimals(value)
+				if err != nil {
+					return nil, err
+				}
+				for _, m := range mergedMappings(merged) {
+					for k, v := range m {
+						if _, exists := values[k]; !exists {
+							values[k] = v
+						}
+					}
+				}
+				continue
+			}
+
+			decoded, err := decodeDecimals(value)
+			if err != nil {
+				return nil, err
+			}
+			values[key.Value] = decoded
+		}
+		return values, nil
+	case yaml.SequenceNode:
+		values := make([]any, 0, len(node.Content))
+		for _, child := range node.Content {
+			decoded, err := decodeDecimals(child)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, decoded)
+		}
+		return values, nil
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!float" {
+			if d, err := ParseDecimal(node.Value); err == nil {
+				return d, nil
+			}
+		}
+	case yaml.DocumentNode:
+	}
+
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// mergedMappings returns the mappings of the value of a merge key, a single
+// mapping or a list of mappings.
+func mergedMappings(value any) []map[string]any {
+	switch v := value.(type) {
+	case map[string]any:
+		return []map[string]any{v}
+	case []any:
+		mappings := make([]map[string]any, 0, len(v))
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok {
+				mappings = append(mappings, m)
+			}
+		}
+		return mappings
+	}
+	return nil
+}
+
+// decodeVariables decodes the variables of the template section again,
+// keeping float literals as Decimal.
+func decodeVariables(root *yaml.Node, cfg *TemplateConfig) error {
+	section := mappingValue(root, "template")
+	for key, values := range map[string]*map[string]any{"variables": &cfg.Variables, "documents": &cfg.Documents} {
+		node := mappingValue(section, key)
+		if node == nil {
+			continue
+		}
+		decoded, err := decodeDecimals(node)
+		if err != nil {
+			return err
+		}
+		if m, ok := decoded.(map[string]any); ok {
+			*values = m
+		}
+	}
+	return nil
+}
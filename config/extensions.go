@@ -0,0 +1,63 @@
+package config
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DefaultExtensions are the extensions of documents and partials if none are
+// configured.
+//
+//nolint:gochecknoglobals
+var DefaultExtensions = []string{".mjml"}
+
+// ExtensionsConfig sets the file extensions of the template sources. Extensions
+// can have several dots like ".mjml.tmpl", the longest matching extension is
+// removed from the template name.
+type ExtensionsConfig struct {
+	// Documents are the extensions of MJML documents
+	Documents []string `yaml:"documents"`
+	// Partials are the extensions of partials
+	Partials []string `yaml:"partials"`
+	// HTML are the extensions of plain HTML documents that skip MJML compilation
+	HTML []string `yaml:"html"`
+}
+
+// DocumentExtensions returns the extensions of MJML and plain HTML documents.
+func (e ExtensionsConfig) DocumentExtensions() []string {
+	extensions := e.Documents
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	return append(append([]string{}, extensions...), e.HTML...)
+}
+
+// PartialExtensions returns the extensions of partials.
+func (e ExtensionsConfig) PartialExtensions() []string {
+	if len(e.Partials) == 0 {
+		return DefaultExtensions
+	}
+	return e.Partials
+}
+
+// IsHTML reports whether ext is the extension of plain HTML documents.
+func (e ExtensionsConfig) IsHTML(ext string) bool {
+	return slices.Contains(e.HTML, ext)
+}
+
+// TrimExtension removes the longest of the extensions from the file name. It
+// returns the removed extension or false if the name has none of them.
+func TrimExtension(name string, extensions []string) (string, string, bool) {
+	sorted := append([]string{}, extensions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+
+	for _, ext := range sorted {
+		if trimmed, ok := strings.CutSuffix(name, ext); ok && trimmed != "" && !strings.HasSuffix(trimmed, "/") {
+			return trimmed, ext, true
+		}
+	}
+	return name, "", false
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/friendsofgo/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the config file names searched by FindConfig, in order.
+var FileNames = []string{"envelopr.yaml", "envelopr.yml", "envelopr.json", "envelopr.toml"} //nolint:gochecknoglobals
+
+var ErrConfigNotFound = errors.New("config file not found")
+
+// FindConfig searches dir and its parent directories for a config file, like
+// git does for the repository.
+func FindConfig(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrap(err, "resolving directory")
+	}
+
+	for current := absDir; ; current = filepath.Dir(current) {
+		for _, name := range FileNames {
+			path := filepath.Join(current, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+
+	return "", errors.Wrapf(ErrConfigNotFound, "no %s in %s or any parent directory", strings.Join(FileNames, ", "), absDir)
+}
+
+// parseFile reads a YAML, JSON or TOML file, depending on its extension, and
+// returns its root node. Empty files return nil.
+func parseFile(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading config file")
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return parseTOML(path, data)
+	}
+
+	// JSON is parsed as YAML, which keeps line and column information
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrapf(err, "unmarshalling config %s", path)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	return doc.Content[0], nil
+}
+
+func parseTOML(path string, data []byte) (*yaml.Node, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	var values map[string]any
+	if _, err := toml.Decode(string(data), &values); err != nil {
+		return nil, errors.Wrapf(err, "unmarshalling config %s", path)
+	}
+
+	var node yaml.Node
+	if err := node.Encode(values); err != nil {
+		return nil, errors.Wrapf(err, "converting config %s", path)
+	}
+
+	return &node, nil
+}
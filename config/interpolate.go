@@ -0,0 +1,93 @@
+package config
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/friendsofgo/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidInterpolation = errors.New("invalid interpolation")
+
+// interpolateNode replaces environment variable references in all scalar values
+// of the node tree. Plain scalars are re-resolved after interpolation, so
+// "${DEBUG:-false}" becomes a boolean.
+func interpolateNode(node *yaml.Node, lookupEnv func(string) (string, bool)) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		// Only interpolate values, keys are left untouched
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := interpolateNode(node.Content[i], lookupEnv); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode, yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := interpolateNode(child, lookupEnv); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		value, err := Interpolate(node.Value, lookupEnv)
+		if err != nil {
+			return errors.Wrapf(err, "line %d", node.Line)
+		}
+		if value != node.Value {
+			node.Value = value
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+	case yaml.AliasNode:
+	}
+
+	return nil
+}
+
+// Interpolate expands "${VAR}" and "${VAR:-default}" references in s. The
+// default is used if the variable is unset or empty, "$$" is an escaped "$".
+func Interpolate(s string, lookupEnv func(string) (string, bool)) (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			sb.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", errors.Wrapf(ErrInvalidInterpolation, "unclosed reference in %q", s)
+			}
+			expr := s[i+2 : i+end]
+
+			name, fallback, hasDefault := strings.Cut(expr, ":-")
+			if name == "" {
+				return "", errors.Wrapf(ErrInvalidInterpolation, "empty variable name in %q", s)
+			}
+
+			value, ok := lookupEnv(name)
+			switch {
+			case (!ok || value == "") && hasDefault:
+				value = fallback
+			case !ok:
+				slog.Warn("Environment variable referenced in config is not set", "variable", name)
+			}
+			sb.WriteString(value)
+			i += end
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+
+	return sb.String(), nil
+}
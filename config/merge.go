@@ -0,0 +1,46 @@
+package config
+
+// DeepMerge merges src over dst and returns the result. Nested maps are merged
+// key by key, all other values from src replace the ones in dst. Neither dst nor
+// src are modified.
+func DeepMerge(dst, src map[string]any) map[string]any {
+	result := make(map[string]any, len(dst)+len(src))
+	for key, val := range dst {
+		result[key] = val
+	}
+
+	for key, val := range src {
+		srcMap, srcIsMap := ToStringMap(val)
+		dstMap, dstIsMap := ToStringMap(result[key])
+		if srcIsMap && dstIsMap {
+			result[key] = DeepMerge(dstMap, srcMap)
+			continue
+		}
+		if srcIsMap {
+			result[key] = srcMap
+			continue
+		}
+		result[key] = val
+	}
+
+	return result
+}
+
+// ToStringMap converts the map types produced by YAML decoding into a
+// map[string]any. Non-string keys are skipped.
+func ToStringMap(value any) (map[string]any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		return v, true
+	case map[any]any:
+		result := make(map[string]any, len(v))
+		for key, val := range v {
+			if strKey, ok := key.(string); ok {
+				result[strKey] = val
+			}
+		}
+		return result, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/friendsofgo/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// CurrentVersion is the version of the config format written by this release.
+	CurrentVersion = 2
+	// legacyVersion is assumed for configs without a version field.
+	legacyVersion = 1
+
+	versionKey = "version"
+)
+
+var ErrUnsupportedMigration = errors.New("unsupported migration")
+
+// migration upgrades a config to version. Migrations edit the file text instead
+// of re-encoding the node tree, so that comments and formatting are kept.
+type migration struct {
+	version     int
+	description string
+	// apply rewrites data, root is the parsed root mapping of data
+	apply func(data []byte, root *yaml.Node) ([]byte, error)
+}
+
+// migrations are applied in order to configs with an older version.
+//
+//nolint:gochecknoglobals
+var migrations = []migration{
+	{
+		version:     2,
+		description: "add the version field",
+	},
+}
+
+// ConfigVersion returns the config format version of data. Configs without a
+// version field are version 1.
+func ConfigVersion(data []byte) (int, error) {
+	root, err := parseMigrationNode(data)
+	if err != nil {
+		return 0, err
+	}
+	return nodeVersion(root)
+}
+
+// Migrate rewrites a YAML config to CurrentVersion and returns the new content
+// together with the descriptions of the applied migrations. Configs that are up
+// to date are returned unchanged.
+func Migrate(data []byte) ([]byte, []string, error) {
+	root, err := parseMigrationNode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	version, err := nodeVersion(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version > CurrentVersion {
+		return nil, nil, errors.Wrapf(ErrUnsupportedMigration, "config version %d is newer than %d", version, CurrentVersion)
+	}
+
+	var applied []string
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if m.apply != nil {
+			if data, err = m.apply(data, root); err != nil {
+				return nil, nil, errors.Wrapf(err, "migrating to version %d", m.version)
+			}
+			if root, err = parseMigrationNode(data); err != nil {
+				return nil, nil, errors.Wrapf(err, "migrating to version %d", m.version)
+			}
+		}
+		applied = append(applied, fmt.Sprintf("version %d: %s", m.version, m.description))
+	}
+	if len(applied) == 0 {
+		return data, nil, nil
+	}
+
+	data, err = setVersion(data, root, CurrentVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, applied, nil
+}
+
+// parseMigrationNode parses data into its root node, empty files result in an
+// empty mapping.
+func parseMigrationNode(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling config")
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.Errorf("expected a mapping, got %s", describeNode(root))
+	}
+	return root, nil
+}
+
+func nodeVersion(root *yaml.Node) (int, error) {
+	node := mappingValue(root, versionKey)
+	if node == nil || node.ShortTag() == "!!null" {
+		return legacyVersion, nil
+	}
+
+	version, err := strconv.Atoi(node.Value)
+	if err != nil || version < legacyVersion {
+		return 0, errors.Errorf("line %d: invalid config version %q", node.Line, node.Value)
+	}
+	return version, nil
+}
+
+// setVersion replaces the version value in data or inserts the version field
+// before the first key of the config, below the comments heading the file.
+func setVersion(data []byte, root *yaml.Node, version int) ([]byte, error) {
+	value := strconv.Itoa(version)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+
+	if node := mappingValue(root, versionKey); node != nil && node.ShortTag() != "!!null" {
+		line := lines[node.Line-1]
+		start := node.Column - 1
+		end := bytes.IndexAny(line[start:], " \t#\r\n")
+		if end < 0 {
+			end = len(line) - start
+		}
+		lines[node.Line-1] = append(append(append([]byte{}, line[:start]...), value...), line[start+end:]...)
+		return bytes.Join(lines, nil), nil
+	}
+
+	if root.Style&yaml.FlowStyle != 0 {
+		return nil, errors.Wrap(ErrUnsupportedMigration, "flow style configs cannot be migrated")
+	}
+
+	field := []byte(versionKey + ": " + value + "\n")
+	if len(root.Content) == 0 {
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		return append(data, field...), nil
+	}
+
+	// Insert above the comment block belonging to the first key
+	first := root.Content[0]
+	index := first.Line - 1
+	if first.HeadComment != "" {
+		index -= bytes.Count([]byte(first.HeadComment), []byte("\n")) + 1
+	}
+	insert := append(field, '\n')
+	if index > 0 && len(bytes.TrimSpace(lines[index-1])) > 0 {
+		insert = field
+	}
+
+	result := make([][]byte, 0, len(lines)+1)
+	result = append(result, lines[:index]...)
+	result = append(result, insert)
+	result = append(result, lines[index:]...)
+	return bytes.Join(result, nil), nil
+}
@@ -0,0 +1,81 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Run("adds version and keeps comments", func(t *testing.T) {
+		r := require.New(t)
+
+		migrated, applied, err := config.Migrate([]byte(`# yaml-language-server: $schema=schema.json
+
+# Directory paths
+paths:
+  documents: "documents" # MJML documents
+`))
+		r.NoError(err)
+		r.Len(applied, 1)
+		r.Equal(`# yaml-language-server: $schema=schema.json
+
+version: 2
+
+# Directory paths
+paths:
+  documents: "documents" # MJML documents
+`, string(migrated))
+
+		version, err := config.ConfigVersion(migrated)
+		r.NoError(err)
+		r.Equal(config.CurrentVersion, version)
+	})
+
+	t.Run("empty config", func(t *testing.T) {
+		r := require.New(t)
+
+		migrated, applied, err := config.Migrate(nil)
+		r.NoError(err)
+		r.Len(applied, 1)
+		r.Equal("version: 2\n", string(migrated))
+	})
+
+	t.Run("up to date config is unchanged", func(t *testing.T) {
+		r := require.New(t)
+
+		data := []byte("version: 2\npaths:\n  documents: documents\n")
+		migrated, applied, err := config.Migrate(data)
+		r.NoError(err)
+		r.Empty(applied)
+		r.Equal(string(data), string(migrated))
+	})
+
+	t.Run("newer version", func(t *testing.T) {
+		r := require.New(t)
+
+		_, _, err := config.Migrate([]byte("version: 99\n"))
+		r.ErrorIs(err, config.ErrUnsupportedMigration)
+	})
+
+	t.Run("load rejects newer version", func(t *testing.T) {
+		r := require.New(t)
+
+		tmpDir, err := os.MkdirTemp("", "envelopr-test")
+		r.NoError(err)
+		defer os.RemoveAll(tmpDir)
+
+		path := filepath.Join(tmpDir, "envelopr.yaml")
+		r.NoError(os.WriteFile(path, []byte("version: 99\n"), 0644))
+
+		_, err = config.LoadConfig(path)
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Equal("version", validationErrs[0].Key)
+		r.Equal(1, validationErrs[0].Position.Line)
+	})
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"maps"
+	"sort"
+)
+
+// ForDocument returns the MJML options of the document with the given name.
+// The overrides in Documents are applied from the least to the most specific
+// rule, see MatchRules. The returned config has no Documents.
+func (m MJMLConfig) ForDocument(name string) MJMLConfig {
+	keys := make([]string, 0, len(m.Documents))
+	for key := range m.Documents {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := m
+	result.Documents = nil
+	for _, i := range MatchRules(keys, name) {
+		result = result.Apply(m.Documents[keys[i]])
+	}
+	return result
+}
+
+// Apply returns a copy of the config with the options set in override. Fonts
+// are added to the configured fonts.
+func (m MJMLConfig) Apply(override MJMLOverride) MJMLConfig {
+	if override.ValidationLevel != "" {
+		m.ValidationLevel = override.ValidationLevel
+	}
+	if override.KeepComments != nil {
+		m.KeepComments = *override.KeepComments
+	}
+	if override.Beautify != nil {
+		m.Beautify = *override.Beautify
+	}
+	if override.Minify != nil {
+		m.Minify = *override.Minify
+	}
+	if len(override.Fonts) > 0 {
+		fonts := maps.Clone(m.Fonts)
+		if fonts == nil {
+			fonts = make(map[string]string, len(override.Fonts))
+		}
+		maps.Copy(fonts, override.Fonts)
+		m.Fonts = fonts
+	}
+	return m
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/friendsofgo/errors"
+)
+
+// DefaultOutputFile writes documents as HTML files mirroring the documents
+// directory.
+const DefaultOutputFile = "{path}.html"
+
+// DefaultAssetsDir is the directory of generated images in the output
+// directory.
+const DefaultAssetsDir = "assets"
+
+// OutputPlaceholders are the placeholders of output path patterns:
+//   - {path}: document name including directories, e.g. marketing/newsletter
+//   - {dir}: directory of the document, empty for top-level documents
+//   - {name}: file name of the document without extension
+//   - {locale}: locale of the document
+//   - {variant}: name of the output variant
+//
+//nolint:gochecknoglobals
+var OutputPlaceholders = []string{"path", "dir", "name", "locale", "variant"}
+
+// PostProcessSteps are the post-processing steps of output variants:
+//   - trim: removes leading and trailing whitespace of the document
+//   - trimLines: removes trailing whitespace of every line
+//   - crlf: converts line endings to CRLF
+//
+//nolint:gochecknoglobals
+var PostProcessSteps = []string{"trim", "trimLines", "crlf"}
+
+var ErrInvalidOutputFile = errors.New("invalid output file")
+
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// OutputVariant is an output variant with its name.
+type OutputVariant struct {
+	Name string
+	OutputConfig
+}
+
+// OutputVariants returns the configured output variants sorted by name. Variants
+// without a file pattern use paths.outputFile. Without configured variants a
+// single unnamed variant is returned.
+func (c *Config) OutputVariants() []OutputVariant {
+	file := c.Paths.OutputFile
+	if file == "" {
+		file = DefaultOutputFile
+	}
+	if len(c.Outputs) == 0 {
+		return []OutputVariant{{OutputConfig: OutputConfig{File: file}}}
+	}
+
+	variants := make([]OutputVariant, 0, len(c.Outputs))
+	for name, output := range c.Outputs {
+		if output.File == "" {
+			output.File = file
+		}
+		variants = append(variants, OutputVariant{Name: name, OutputConfig: output})
+	}
+	sort.Slice(variants, func(i, j int) bool {
+		return variants[i].Name < variants[j].Name
+	})
+	return variants
+}
+
+// OutputExtensions returns the file extensions of all output variants.
+func (c *Config) OutputExtensions() []string {
+	var extensions []string
+	for _, variant := range c.OutputVariants() {
+		ext := path.Ext(variant.File)
+		if ext != "" && !slices.Contains(extensions, ext) {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+// checkOutputFile returns a description of the problem of an output path
+// pattern or an empty string if it is valid. Empty patterns use the default.
+func checkOutputFile(pattern string) string {
+	if pattern == "" {
+		return ""
+	}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(pattern, -1) {
+		if !slices.Contains(OutputPlaceholders, match[1]) {
+			return "unknown placeholder {" + match[1] + "}, expected one of {" + strings.Join(OutputPlaceholders, "}, {") + "}"
+		}
+	}
+	if strings.HasPrefix(pattern, "/") || slices.Contains(strings.Split(pattern, "/"), "..") {
+		return "must be a path inside the output directory"
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return "must be a file path"
+	}
+	return ""
+}
+
+// outputSeparators are removed together with an empty placeholder.
+const outputSeparators = ".-_"
+
+// removeEmpty removes the markers of empty placeholders with the separator
+// before them, or with the separator after them at the start of a path segment,
+// so that e.g. {locale}.{name}.html does not become a hidden file.
+func removeEmpty(expanded string) string {
+	var b strings.Builder
+	for i := 0; i < len(expanded); i++ {
+		if expanded[i] != '\x00' {
+			b.WriteByte(expanded[i])
+			continue
+		}
+		written := b.String()
+		switch {
+		case written != "" && strings.ContainsRune(outputSeparators, rune(written[len(written)-1])):
+			b.Reset()
+			b.WriteString(written[:len(written)-1])
+		case (written == "" || strings.HasSuffix(written, "/")) &&
+			i+1 < len(expanded) && strings.ContainsRune(outputSeparators, rune(expanded[i+1])):
+			i++
+		}
+	}
+	return b.String()
+}
+
+// ExpandOutputFile replaces the placeholders of an output path pattern with
+// values. An empty value also removes a ".", "-" or "_" next to the
+// placeholder, so "{name}.{locale}.html" and "{locale}_{name}.html" become
+// "welcome.html" without locale. The result must be a relative path that stays
+// inside the output directory.
+func ExpandOutputFile(pattern string, values map[string]string) (string, error) {
+	var unknown string
+	expanded := placeholderPattern.ReplaceAllStringFunc(pattern, func(match string) string {
+		name := match[1 : len(match)-1]
+		if !slices.Contains(OutputPlaceholders, name) {
+			unknown = name
+			return match
+		}
+		value := values[name]
+		if value == "" {
+			// Marks an empty value, removed below with its separator
+			return "\x00"
+		}
+		return value
+	})
+	if unknown != "" {
+		return "", errors.Wrapf(ErrInvalidOutputFile, "%s: unknown placeholder {%s}", pattern, unknown)
+	}
+
+	expanded = strings.TrimPrefix(path.Clean("/"+removeEmpty(expanded)), "/")
+
+	if expanded == "" || strings.HasSuffix(pattern, "/") {
+		return "", errors.Wrapf(ErrInvalidOutputFile, "%s: expands to a directory", pattern)
+	}
+	return expanded, nil
+}
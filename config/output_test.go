@@ -0,0 +1,46 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+func TestExpandOutputFile(t *testing.T) {
+	values := map[string]string{"path": "shop/invoice", "dir": "shop", "name": "invoice"}
+
+	for _, tt := range []struct {
+		pattern  string
+		expected string
+	}{
+		{"{path}.html", "shop/invoice.html"},
+		{"{name}.{locale}.html", "invoice.html"},
+		{"{name}-{locale}.html", "invoice.html"},
+		{"{name}_{locale}.html", "invoice.html"},
+		{"{locale}.{name}.html", "invoice.html"},
+		{"{locale}_{name}.html", "invoice.html"},
+		{"{dir}/{locale}-{name}.html", "shop/invoice.html"},
+		{"{locale}/{name}.html", "invoice.html"},
+		{"{variant}/{dir}/{name}.{locale}.html", "shop/invoice.html"},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			r := require.New(t)
+
+			expanded, err := config.ExpandOutputFile(tt.pattern, values)
+			r.NoError(err)
+			r.Equal(tt.expected, expanded)
+		})
+	}
+
+	t.Run("invalid patterns", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := config.ExpandOutputFile("{lang}.html", values)
+		r.ErrorIs(err, config.ErrInvalidOutputFile)
+
+		_, err = config.ExpandOutputFile("{locale}", values)
+		r.ErrorIs(err, config.ErrInvalidOutputFile)
+	})
+}
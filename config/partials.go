@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/friendsofgo/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// PartialDir is a directory of partials. Partials of a directory with a
+// namespace are called with the namespace as prefix, e.g. "brand/button".
+type PartialDir struct {
+	Path      string `yaml:"path"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// PartialDirs lists the partial directories. If the same partial name is found
+// in several directories, the partial of the earlier directory is used.
+//
+// In YAML it is a single path, a list of paths or a list of mappings with path
+// and namespace.
+type PartialDirs []PartialDir
+
+var ErrInvalidPartialDirs = errors.New("invalid partial directories")
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *PartialDirs) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind { //nolint:exhaustive
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!null" || node.Value == "" {
+			*d = nil
+			return nil
+		}
+		*d = PartialDirs{{Path: node.Value}}
+		return nil
+	case yaml.SequenceNode:
+		dirs := make(PartialDirs, 0, len(node.Content))
+		for _, item := range node.Content {
+			switch item.Kind { //nolint:exhaustive
+			case yaml.ScalarNode:
+				dirs = append(dirs, PartialDir{Path: item.Value})
+			case yaml.MappingNode:
+				var dir PartialDir
+				if err := item.Decode(&dir); err != nil {
+					return err
+				}
+				dirs = append(dirs, dir)
+			default:
+				return errors.Wrapf(ErrInvalidPartialDirs, "line %d: expected a path or a mapping with path and namespace", item.Line)
+			}
+		}
+		*d = dirs
+		return nil
+	default:
+		return errors.Wrapf(ErrInvalidPartialDirs, "line %d: expected a path or a list of directories", node.Line)
+	}
+}
+
+// MarshalYAML implements yaml.Marshaler. A single directory without namespace
+// is written as path.
+func (d PartialDirs) MarshalYAML() (any, error) {
+	if len(d) == 1 && d[0].Namespace == "" {
+		return d[0].Path, nil
+	}
+	return []PartialDir(d), nil
+}
+
+// schema implements schemaProvider.
+func (PartialDirs) schema() map[string]any {
+	dir := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"path"},
+		"properties": map[string]any{
+			"path": map[string]any{
+				"description": "Directory containing partial templates",
+				"type":        "string",
+			},
+			"namespace": map[string]any{
+				"description": "Prefix of the partial names, e.g. brand for brand/button",
+				"type":        "string",
+			},
+		},
+	}
+
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": []string{"string", "null"}},
+			map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"oneOf": []any{map[string]any{"type": "string"}, dir},
+				},
+			},
+		},
+	}
+}
+
+// checkNode implements nodeChecker, reporting unknown keys and invalid
+// namespaces with their position.
+func (PartialDirs) checkNode(v *validator, node *yaml.Node, key string) {
+	if node.Kind == yaml.ScalarNode {
+		return
+	}
+	if node.Kind != yaml.SequenceNode {
+		v.addError(node, key, "expected a path or a list of directories, got %s", describeNode(node))
+		return
+	}
+
+	for i, item := range node.Content {
+		itemKey := fmt.Sprintf("%s[%d]", key, i)
+		switch item.Kind { //nolint:exhaustive
+		case yaml.ScalarNode:
+			if item.Value == "" {
+				v.addError(item, itemKey, "path is required")
+			}
+		case yaml.MappingNode:
+			v.checkNode(item, reflect.TypeOf(PartialDir{}), itemKey)
+			if path := mappingValue(item, "path"); path == nil || path.Value == "" {
+				v.addError(item, itemKey, "path is required")
+			}
+			if namespace := mappingValue(item, "namespace"); namespace != nil && !validNamespace(namespace.Value) {
+				v.addError(namespace, joinKey(itemKey, "namespace"), "invalid namespace %q, expected names separated by /", namespace.Value)
+			}
+		default:
+			v.addError(item, itemKey, "expected a path or a mapping with path and namespace, got %s", describeNode(item))
+		}
+	}
+}
+
+// TemplateName returns the name of a partial of the directory.
+func (d PartialDir) TemplateName(name string) string {
+	if d.Namespace == "" {
+		return name
+	}
+	return strings.Trim(d.Namespace, "/") + "/" + name
+}
+
+func validNamespace(namespace string) bool {
+	if namespace == "" {
+		return true
+	}
+	for _, segment := range strings.Split(strings.Trim(namespace, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." || IsPattern(segment) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// IsPattern reports whether the given document key contains glob characters.
+func IsPattern(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+// MatchPattern reports whether a document name like "marketing/2024/spring"
+// matches a glob pattern. A "*" matches within a single path segment, while a
+// "**" segment matches any number of segments (including none).
+func MatchPattern(pattern, name string) bool {
+	return matchSegments(splitPath(pattern), splitPath(name))
+}
+
+// PatternSpecificity returns a score for ordering glob patterns. Patterns with
+// more literal segments are more specific, "**" segments make a pattern less
+// specific.
+func PatternSpecificity(pattern string) int {
+	score := 0
+	for _, segment := range splitPath(pattern) {
+		switch {
+		case segment == "**":
+			score--
+		case !IsPattern(segment):
+			score += 2
+		}
+	}
+	return score
+}
+
+type ruleKind int
+
+const (
+	ruleDirectory ruleKind = iota
+	ruleGlob
+	ruleDocument
+)
+
+// MatchRules returns the indexes of the rule paths that apply to the document
+// name, ordered from the least to the most specific rule:
+//  1. directory rules, from the top-level directory down to the document's directory
+//  2. glob rules like "marketing/*" or "**/receipt", less specific patterns first
+//  3. exact document rules
+//
+// Rules of the same specificity keep their order in paths.
+func MatchRules(paths []string, name string) []int {
+	type match struct {
+		kind  ruleKind
+		score int
+		index int
+	}
+
+	var matches []match
+	for i, rulePath := range paths {
+		rulePath = strings.Trim(rulePath, "/")
+		switch {
+		case rulePath == name:
+			matches = append(matches, match{kind: ruleDocument, index: i})
+		case IsPattern(rulePath):
+			if MatchPattern(rulePath, name) {
+				matches = append(matches, match{kind: ruleGlob, score: PatternSpecificity(rulePath), index: i})
+			}
+		case strings.HasPrefix(name, rulePath+"/"):
+			matches = append(matches, match{kind: ruleDirectory, score: strings.Count(rulePath, "/"), index: i})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].kind != matches[j].kind {
+			return matches[i].kind < matches[j].kind
+		}
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		return matches[i].index < matches[j].index
+	})
+
+	indexes := make([]int, len(matches))
+	for i, m := range matches {
+		indexes[i] = m.index
+	}
+	return indexes
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive "**" and try every possible split
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
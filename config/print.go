@@ -0,0 +1,92 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/friendsofgo/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// PrintConfig writes the fully resolved config as YAML. Every value is annotated
+// with the file it came from, values that are not set in any file are marked as
+// defaults.
+func PrintConfig(w io.Writer, path string, opts ...Option) error {
+	l := newLoader(opts)
+	config, v, err := l.load(path)
+	if err != nil {
+		return err
+	}
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+
+	var out yaml.Node
+	if err := out.Encode(config); err != nil {
+		return errors.Wrap(err, "encoding config")
+	}
+	l.annotate(&out, l.root)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&out); err != nil {
+		return errors.Wrap(err, "writing config")
+	}
+
+	return encoder.Close()
+}
+
+// annotate adds the origin of the matching source node as comment to every
+// value of out. src is nil for values that are not set in any file.
+func (l *loader) annotate(out, src *yaml.Node) {
+	switch out.Kind {
+	case yaml.MappingNode:
+		if len(out.Content) == 0 {
+			out.LineComment = l.originComment(src)
+			return
+		}
+		for i := 0; i+1 < len(out.Content); i += 2 {
+			var srcValue *yaml.Node
+			if src != nil && src.Kind == yaml.MappingNode {
+				srcValue = mappingValue(src, out.Content[i].Value)
+			}
+			l.annotate(out.Content[i+1], srcValue)
+		}
+	case yaml.SequenceNode:
+		if len(out.Content) == 0 {
+			out.LineComment = l.originComment(src)
+			return
+		}
+		for i, item := range out.Content {
+			srcItem := src
+			if src != nil && src.Kind == yaml.SequenceNode && i < len(src.Content) {
+				srcItem = src.Content[i]
+			}
+			l.annotate(item, srcItem)
+		}
+	case yaml.DocumentNode, yaml.ScalarNode, yaml.AliasNode:
+		out.LineComment = l.originComment(src)
+	}
+}
+
+func (l *loader) originComment(src *yaml.Node) string {
+	if src == nil {
+		return "default"
+	}
+
+	origin := l.origins[src]
+	cwd, err := os.Getwd()
+	if err != nil {
+		return origin
+	}
+	absPath, err := filepath.Abs(origin)
+	if err != nil {
+		return origin
+	}
+	if relPath, err := filepath.Rel(cwd, absPath); err == nil && !strings.HasPrefix(relPath, "..") {
+		return relPath
+	}
+	return absPath
+}
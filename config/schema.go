@@ -0,0 +1,180 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// SchemaURL is the location of the published JSON Schema for envelopr.yaml.
+const SchemaURL = "https://raw.githubusercontent.com/esdete2/envelopr/master/envelopr.schema.json"
+
+// descriptions of the config keys, kept in line with DefaultConfigTemplate.
+//
+//nolint:gochecknoglobals
+var descriptions = map[string]string{
+	"version":                          "Version of the config format, run envelopr config migrate to update older configs",
+	"paths":                            "Directory paths for templates, partials and output",
+	"paths.documents":                  "Main directory containing your MJML templates",
+	"paths.partials":                   "Directories containing partial templates that can be included, a path or a list of paths or mappings with path and namespace. Earlier directories take precedence",
+	"paths.output":                     "Output directory for compiled HTML files",
+	"paths.outputFile":                 "Path pattern of output files relative to the output directory with the placeholders {path}, {dir}, {name}, {locale} and {variant}, defaults to {path}.html",
+	"paths.assets":                     "Directory of images generated by templates, defaults to the assets directory in the output directory",
+	"paths.styles":                     "Directory of CSS files included by templates with stylesheet and inlineStylesheet, defaults to the styles directory next to the config file",
+	"paths.assetsUrl":                  "URL prefix of generated images in the output HTML, e.g. https://cdn.example.com/email, defaults to the path of the assets directory relative to each output file",
+	"mjml":                             "MJML compilation settings",
+	"mjml.validationLevel":             "Validation level: strict validates and fails on any error, soft shows warnings but continues, skip skips validation entirely",
+	"mjml.keepComments":                "Keep comments in output HTML",
+	"mjml.beautify":                    "Beautify the output HTML",
+	"mjml.minify":                      "Minify the output HTML",
+	"mjml.fonts":                       "Custom fonts to include, mapping font names to stylesheet URLs",
+	"mjml.documents":                   "Per-document MJML options, keyed by document name, directory or glob pattern. Documents can also set them in the mjml section of their front matter",
+	"mjml.documents.*":                 "MJML options of the matching documents, unset options keep the value of less specific rules",
+	"mjml.documents.*.validationLevel": "Validation level of the matching documents",
+	"mjml.documents.*.keepComments":    "Keep comments in the output HTML of the matching documents",
+	"mjml.documents.*.beautify":        "Beautify the output HTML of the matching documents",
+	"mjml.documents.*.minify":          "Minify the output HTML of the matching documents",
+	"mjml.documents.*.fonts":           "Fonts added to the configured fonts for the matching documents",
+	"mjml.head":                        "Fragments added to the mj-head of every MJML document, documents can opt out with head: false in their front matter",
+	"mjml.head.*":                      "Head fragment, set exactly one of mjml, partial and css",
+	"mjml.head.*.mjml":                 "MJML added to the head, it may use template expressions",
+	"mjml.head.*.partial":              "Name of a partial rendered with the data of the document",
+	"mjml.head.*.css":                  "Stylesheet added as mj-style, relative to the config file",
+	"mjml.head.*.inline":               "Add the stylesheet with inline=\"inline\", so that MJML inlines it into the style attributes",
+	"template":                         "Template processing settings",
+	"template.locale":                  "Default locale of the documents, a \"locale\" variable overrides it per document",
+	"template.variables":               "Global static variables available to all templates",
+	"template.documents":               "Per-document variables, keyed by document name, directory or glob pattern",
+	"template.decimals":                "Keep numbers like 10.00 in variables as exact decimals with their scale instead of floats",
+	"template.timezone":                "Time zone of formatted dates as IANA name, e.g. Europe/Berlin, a \"timezone\" variable overrides it per document",
+	"template.event":                   "Variable holding the calendar event of a document, e.g. event, no calendar files are written if empty",
+	"template.escape":                  "Escaping of template values: html escapes them depending on where they are written, none writes them unchanged",
+	"template.limits":                  "Limits of rendering a document, for templates from less-trusted authors",
+	"template.limits.timeout":          "Maximum duration of rendering a document, e.g. 5s",
+	"template.limits.maxOutputSize":    "Maximum size of a rendered document in bytes, 0 for no limit",
+	"template.limits.maxDepth":         "Maximum nesting depth of template calls, 0 for no limit",
+	"template.restricted":              "Disable template functions and variables giving access to the environment, files or code outside of the template",
+	"template.duplicates":              "Handling of templates defined in more than one file: warn logs a warning, error fails the document",
+	"build":                            "Build settings",
+	"build.time":                       "Fixed build time (RFC 3339) for reproducible builds, defaults to SOURCE_DATE_EPOCH or the current time",
+	"build.commit":                     "Git commit exposed as .Envelopr.Commit, defaults to the commit of the config directory",
+	"build.env":                        "Environment variables exposed to templates as .Envelopr.Env",
+	"outputs":                          "Named output variants, every document is written once for each variant",
+	"outputs.*":                        "Output variant",
+	"outputs.*.file":                   "Path pattern of the variant, defaults to paths.outputFile",
+	"outputs.*.mjml":                   "MJML options of the variant, applied over the document options",
+	"outputs.*.mjml.validationLevel":   "Validation level of the variant",
+	"outputs.*.mjml.keepComments":      "Keep comments in the output HTML of the variant",
+	"outputs.*.mjml.beautify":          "Beautify the output HTML of the variant",
+	"outputs.*.mjml.minify":            "Minify the output HTML of the variant",
+	"outputs.*.mjml.fonts":             "Fonts added to the configured fonts for the variant",
+	"outputs.*.postProcess":            "Post-processing steps applied to the compiled HTML in order: trim, trimLines or crlf",
+	"extensions":                       "File extensions of documents and partials, extensions can have several dots like .mjml.tmpl",
+	"extensions.documents":             "Extensions of MJML documents, defaults to .mjml",
+	"extensions.partials":              "Extensions of partials, defaults to .mjml",
+	"extensions.html":                  "Extensions of plain HTML documents, they are rendered as templates but not compiled by MJML",
+	"profiles":                         "Profiles are merged over this config when selected with --profile",
+	"extends":                          "Base config files this file is merged over, relative to this file",
+	"include":                          "Config fragments merged below this file, relative to this file",
+}
+
+// enums lists the allowed values of config keys.
+//
+//nolint:gochecknoglobals
+var enums = map[string][]string{
+	"mjml.validationLevel":             ValidationLevels,
+	"mjml.documents.*.validationLevel": ValidationLevels,
+	"outputs.*.mjml.validationLevel":   ValidationLevels,
+	"template.duplicates":              DuplicateModes,
+	"template.escape":                  EscapeModes,
+	"outputs.*.postProcess.*":          PostProcessSteps,
+}
+
+// Schema returns a JSON Schema describing the config file.
+func Schema() map[string]any {
+	schema := schemaFor(reflect.TypeOf(Config{}), "")
+	schema["type"] = "object"
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = SchemaURL
+	schema["title"] = "envelopr config"
+
+	properties, _ := schema["properties"].(map[string]any)
+	properties[profilesKey] = map[string]any{
+		"description":          descriptions[profilesKey],
+		"type":                 []string{"object", "null"},
+		"additionalProperties": map[string]any{"$ref": "#"},
+	}
+	for _, key := range []string{extendsKey, includeKey} {
+		properties[key] = map[string]any{
+			"description": descriptions[key],
+			"oneOf": []any{
+				map[string]any{"type": "string"},
+				map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+		}
+	}
+
+	return schema
+}
+
+// SchemaJSON returns the indented JSON encoding of Schema.
+func SchemaJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaProvider is implemented by config types with custom decoding.
+type schemaProvider interface {
+	schema() map[string]any
+}
+
+func schemaFor(t reflect.Type, key string) map[string]any {
+	if provider, ok := reflect.Zero(t).Interface().(schemaProvider); ok {
+		schema := provider.schema()
+		if description, ok := descriptions[key]; ok {
+			schema["description"] = description
+		}
+		return schema
+	}
+
+	schema := make(map[string]any)
+	if description, ok := descriptions[key]; ok {
+		schema["description"] = description
+	}
+
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.Pointer:
+		return schemaFor(t.Elem(), key)
+	case reflect.Struct:
+		properties := make(map[string]any)
+		for name, field := range structFields(t) {
+			properties[name] = schemaFor(field.Type, joinKey(key, name))
+		}
+		schema["type"] = []string{"object", "null"}
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+	case reflect.Map:
+		schema["type"] = []string{"object", "null"}
+		if t.Elem().Kind() == reflect.Interface {
+			schema["additionalProperties"] = true
+		} else {
+			schema["additionalProperties"] = schemaFor(t.Elem(), joinKey(key, "*"))
+		}
+	case reflect.Slice:
+		schema["type"] = []string{"array", "null"}
+		schema["items"] = schemaFor(t.Elem(), joinKey(key, "*"))
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int64:
+		schema["type"] = "integer"
+	case reflect.String:
+		schema["type"] = "string"
+		if values, ok := enums[key]; ok {
+			schema["enum"] = values
+		}
+	}
+
+	return schema
+}
@@ -0,0 +1,63 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+func TestSchema(t *testing.T) {
+	t.Run("published schema is up to date", func(t *testing.T) {
+		r := require.New(t)
+
+		expected, err := config.SchemaJSON()
+		r.NoError(err)
+
+		published, err := os.ReadFile("../envelopr.schema.json")
+		r.NoError(err)
+		r.Equal(string(expected), string(published), "run `go run . config schema > envelopr.schema.json`")
+	})
+
+	t.Run("all properties are described", func(t *testing.T) {
+		r := require.New(t)
+
+		var check func(key string, schema map[string]any)
+		check = func(key string, schema map[string]any) {
+			properties, _ := schema["properties"].(map[string]any)
+			for name, property := range properties {
+				propertySchema, ok := property.(map[string]any)
+				r.True(ok)
+				childKey := name
+				if key != "" {
+					childKey = key + "." + name
+				}
+				r.NotEmpty(propertySchema["description"], "missing description for %s", childKey)
+				check(childKey, propertySchema)
+			}
+		}
+		check("", config.Schema())
+	})
+
+	t.Run("default config is valid", func(t *testing.T) {
+		r := require.New(t)
+
+		tmpDir, err := os.MkdirTemp("", "envelopr-test")
+		r.NoError(err)
+		defer os.RemoveAll(tmpDir)
+
+		path := filepath.Join(tmpDir, "envelopr.yaml")
+		r.NoError(config.CreateDefaultConfig(path, "documents", "partials", "output", false))
+
+		content, err := os.ReadFile(path)
+		r.NoError(err)
+		r.Contains(string(content), "# yaml-language-server: $schema="+config.SchemaURL)
+
+		cfg, err := config.LoadConfig(path)
+		r.NoError(err)
+		r.Equal(config.CurrentVersion, cfg.Version)
+	})
+}
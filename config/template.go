@@ -1,13 +1,30 @@
 package config
 
-const DefaultConfigTemplate = `# Directory paths for templates, partials and output
+const DefaultConfigTemplate = "# yaml-language-server: $schema=" + SchemaURL + `
+
+# Version of the config format
+version: 2
+
+# Directory paths for templates, partials and output
 paths:
   # Main directory containing your MJML templates
   documents: %q
-  # Directory containing partial templates that can be included
+  # Directory containing partial templates that can be included.
+  # A list of directories is searched in order, shared libraries can get a namespace:
+  # partials:
+  #   - partials
+  #   - path: ../brand-components
+  #     namespace: brand
   partials: %q
   # Output directory for compiled HTML files
   output: %q
+  # Path pattern of output files with the placeholders {path}, {dir}, {name}, {locale} and {variant}
+  # outputFile: "{path}.html"
+  # Directory and URL prefix of images generated by templates, like QR codes
+  # assets: dist/assets
+  # assetsUrl: https://cdn.example.com/email
+  # Directory of CSS files included with {{ stylesheet "name" }}
+  # styles: styles
 
 # MJML compilation settings
 mjml:
@@ -25,9 +42,24 @@ mjml:
   # Custom fonts to include
   fonts:
     # Roboto: https://fonts.googleapis.com/css?family=Roboto
+  # Per-document options by document name, directory or glob pattern
+  documents:
+    # transactional:
+      # validationLevel: strict
+  # Fragments added to the mj-head of every document: mjml, partial or css
+  head:
+    # - mjml: <mj-attributes><mj-all font-family="Arial, sans-serif" /></mj-attributes>
+    # - partial: head/breakpoints
+    # - css: styles/dark-mode.css
+    #   inline: false
 
 # Template processing settings
 template:
+  # Default locale of the documents, a "locale" variable overrides it per document
+  # locale: en-US
+  # Time zone of formatted dates, a "timezone" variable overrides it per document
+  # timezone: Europe/Berlin
+
   # Global static variables available to all templates
   variables:
     # companyName: ACME Corp
@@ -37,4 +69,67 @@ template:
     # Static variables for a template named newsletter.mjml
     # newsletter:
       # shopUrl: https://example.shop
+
+  # Keep numbers like 10.00 in variables as exact decimals with their scale
+  # decimals: true
+
+  # Variable holding the calendar event of a document, written as .ics file
+  # event: event
+
+  # Escaping of variables: html escapes them depending on whether they are
+  # written into text, attributes or URLs, none writes them unchanged
+  escape: html
+
+  # Limits for templates from less-trusted authors, 0 or empty disables a limit
+  # limits:
+    # timeout: 5s
+    # maxOutputSize: 1048576
+    # maxDepth: 50
+  # Disable functions and variables accessing the environment or files
+  # restricted: true
+
+  # Handling of templates defined in more than one file, e.g. two partials with
+  # the same define block: warn or error
+  duplicates: warn
+
+# Build settings
+build:
+  # Fixed build time (RFC 3339) for reproducible builds
+  # Defaults to SOURCE_DATE_EPOCH or the current time
+  # time: 2024-01-01T00:00:00Z
+  # Git commit exposed as .Envelopr.Commit, defaults to the commit of the config directory
+  # commit: ${CI_COMMIT_SHA}
+  # Environment variables exposed to templates as .Envelopr.Env
+  env:
+    # - ENVIRONMENT
+
+# File extensions of documents and partials
+extensions:
+  # MJML documents
+  documents: [.mjml]
+  # Partials, add .html for plain HTML snippets used in mj-raw
+  partials: [.mjml]
+  # Plain HTML documents that skip the MJML compilation
+  # html: [.html, .gohtml]
+
+# Named output variants, every document is written once for each variant
+# outputs:
+  # min:
+    # file: "{path}.min.html"
+    # mjml:
+      # minify: true
+    # Post-processing steps: trim, trimLines, crlf
+    # postProcess: [trim]
+
+# Shared config files this file is merged over, relative to this file
+# extends: ../shared/envelopr.yaml
+
+# Profiles are merged over this config when selected with --profile.
+# A profile can also live in a separate file, e.g. envelopr.staging.yaml.
+# Values can reference environment variables: ${VAR} or ${VAR:-default}
+profiles:
+  # staging:
+    # template:
+      # variables:
+        # baseUrl: https://staging.example.com
 `
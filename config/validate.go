@@ -0,0 +1,441 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationLevels are the validation levels supported by MJML.
+var ValidationLevels = []string{"strict", "soft", "skip"} //nolint:gochecknoglobals
+
+const (
+	// DuplicatesWarn logs a warning for templates defined in more than one file.
+	DuplicatesWarn = "warn"
+	// DuplicatesError fails rendering of documents using duplicate templates.
+	DuplicatesError = "error"
+)
+
+// DuplicateModes are the supported handlings of duplicate template definitions.
+var DuplicateModes = []string{DuplicatesWarn, DuplicatesError} //nolint:gochecknoglobals
+
+const (
+	// EscapeHTML escapes values depending on their context in the HTML.
+	EscapeHTML = "html"
+	// EscapeNone writes values unescaped.
+	EscapeNone = "none"
+)
+
+// EscapeModes are the supported escapings of template values.
+var EscapeModes = []string{EscapeHTML, EscapeNone} //nolint:gochecknoglobals
+
+// Position is the location of a value in a config file.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		// TOML files are converted without the positions of their keys
+		if strings.EqualFold(filepath.Ext(p.File), ".toml") {
+			return p.File + " (TOML positions are unavailable)"
+		}
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// ValidationError describes an invalid config value and where it was found.
+type ValidationError struct {
+	Position Position
+	Key      string
+	Message  string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %s", e.Position, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Position, e.Key, e.Message)
+}
+
+// ValidationErrors collects all problems found in a config.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// validator checks a YAML node tree against the config structure and records
+// the position of every key.
+type validator struct {
+	file      string
+	origins   map[*yaml.Node]string
+	positions map[string]Position
+	errs      ValidationErrors
+}
+
+func (v *validator) position(node *yaml.Node) Position {
+	return Position{
+		File:   v.origins[node],
+		Line:   node.Line,
+		Column: node.Column,
+	}
+}
+
+func (v *validator) addError(node *yaml.Node, key, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{
+		Position: v.position(node),
+		Key:      key,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem() //nolint:gochecknoglobals
+
+// nodeChecker is implemented by config types with custom decoding that check
+// their nodes themselves.
+type nodeChecker interface {
+	checkNode(v *validator, node *yaml.Node, key string)
+}
+
+// checkNode validates that node can be decoded into a value of type t.
+func (v *validator) checkNode(node *yaml.Node, t reflect.Type, key string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	// Null values leave the field at its zero value
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null" {
+		return
+	}
+
+	// Types with custom decoding validate themselves
+	if checker, ok := reflect.Zero(t).Interface().(nodeChecker); ok {
+		checker.checkNode(v, node, key)
+		return
+	}
+	if t.Implements(unmarshalerType) || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.Pointer:
+		v.checkNode(node, t.Elem(), key)
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.addError(node, key, "expected a mapping, got %s", describeNode(node))
+			return
+		}
+		fields := structFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			childKey := joinKey(key, keyNode.Value)
+			field, ok := fields[keyNode.Value]
+			if !ok {
+				v.addError(keyNode, childKey, "unknown field%s", suggest(keyNode.Value, fields))
+				continue
+			}
+			v.positions[childKey] = v.position(valueNode)
+			v.checkNode(valueNode, field.Type, childKey)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.addError(node, key, "expected a mapping, got %s", describeNode(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childKey := joinKey(key, node.Content[i].Value)
+			v.positions[childKey] = v.position(node.Content[i+1])
+			v.checkNode(node.Content[i+1], t.Elem(), childKey)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.addError(node, key, "expected a list, got %s", describeNode(node))
+			return
+		}
+		for i, child := range node.Content {
+			childKey := fmt.Sprintf("%s[%d]", key, i)
+			v.positions[childKey] = v.position(child)
+			v.checkNode(child, t.Elem(), childKey)
+		}
+	case reflect.Interface:
+		// Any value is accepted
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!bool" {
+			v.addError(node, key, "expected a boolean, got %s", describeNode(node))
+		}
+	case reflect.Int, reflect.Int64:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!int" {
+			v.addError(node, key, "expected an integer, got %s", describeNode(node))
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			v.addError(node, key, "expected a string, got %s", describeNode(node))
+		}
+	}
+}
+
+// checkValues validates the values of the decoded config.
+func (v *validator) checkValues(cfg *Config) {
+	if cfg.Version < 0 || cfg.Version > CurrentVersion {
+		v.addValueError(versionKey, "unsupported config version %d, this release supports up to version %d", cfg.Version, CurrentVersion)
+	}
+
+	if level := cfg.MJML.ValidationLevel; level != "" && !slices.Contains(ValidationLevels, level) {
+		v.addValueError("mjml.validationLevel", "invalid value %q, expected one of %s", level, strings.Join(ValidationLevels, ", "))
+	}
+	for name, override := range cfg.MJML.Documents {
+		if level := override.ValidationLevel; level != "" && !slices.Contains(ValidationLevels, level) {
+			key := joinKey(joinKey("mjml.documents", name), "validationLevel")
+			v.addValueError(key, "invalid value %q, expected one of %s", level, strings.Join(ValidationLevels, ", "))
+		}
+	}
+
+	for i, fragment := range cfg.MJML.Head {
+		key := fmt.Sprintf("mjml.head[%d]", i)
+		set := 0
+		for _, value := range []string{fragment.MJML, fragment.Partial, fragment.CSS} {
+			if value != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			v.addValueError(key, "expected exactly one of mjml, partial and css")
+		}
+		if fragment.Inline && fragment.CSS == "" {
+			v.addValueError(key, "inline is only supported for css")
+		}
+	}
+
+	if mode := cfg.Template.Duplicates; mode != "" && !slices.Contains(DuplicateModes, mode) {
+		v.addValueError("template.duplicates", "invalid value %q, expected one of %s", mode, strings.Join(DuplicateModes, ", "))
+	}
+	if mode := cfg.Template.Escape; mode != "" && !slices.Contains(EscapeModes, mode) {
+		v.addValueError("template.escape", "invalid value %q, expected one of %s", mode, strings.Join(EscapeModes, ", "))
+	}
+
+	if timezone := cfg.Template.Timezone; timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			v.addValueError("template.timezone", "unknown time zone %q, expected an IANA name like Europe/Berlin", timezone)
+		}
+	}
+	if timeout := cfg.Template.Limits.Timeout; timeout != "" {
+		if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+			v.addValueError("template.limits.timeout", "invalid duration %q, expected a positive duration like 5s", timeout)
+		}
+	}
+	for _, limit := range []struct {
+		key   string
+		value int
+	}{
+		{"template.limits.maxOutputSize", cfg.Template.Limits.MaxOutputSize},
+		{"template.limits.maxDepth", cfg.Template.Limits.MaxDepth},
+	} {
+		if limit.value < 0 {
+			v.addValueError(limit.key, "must not be negative, use 0 for no limit")
+		}
+	}
+
+	v.checkOutputs(cfg)
+
+	for _, field := range []struct {
+		key        string
+		extensions []string
+	}{
+		{"extensions.documents", cfg.Extensions.Documents},
+		{"extensions.partials", cfg.Extensions.Partials},
+		{"extensions.html", cfg.Extensions.HTML},
+	} {
+		for i, ext := range field.extensions {
+			if !strings.HasPrefix(ext, ".") || len(ext) < 2 || strings.ContainsAny(ext, "/\\*?[") {
+				v.addValueError(fmt.Sprintf("%s[%d]", field.key, i), "invalid extension %q, expected a file extension like .mjml", ext)
+			}
+		}
+	}
+	for _, ext := range cfg.Extensions.HTML {
+		if slices.Contains(cfg.Extensions.Documents, ext) {
+			v.addValueError("extensions.html", "extension %q is also listed in extensions.documents", ext)
+		}
+	}
+
+	if cfg.Build.Time != "" {
+		if _, err := time.Parse(time.RFC3339, cfg.Build.Time); err != nil {
+			v.addValueError("build.time", "invalid RFC 3339 time %q", cfg.Build.Time)
+		}
+	}
+}
+
+// checkOutputs validates the output file patterns and variants.
+func (v *validator) checkOutputs(cfg *Config) {
+	if problem := checkOutputFile(cfg.Paths.OutputFile); problem != "" {
+		v.addValueError("paths.outputFile", "%s", problem)
+	}
+	if len(cfg.Outputs) == 0 {
+		return
+	}
+
+	files := make(map[string]string)
+	for _, variant := range cfg.OutputVariants() {
+		key := joinKey(outputsKey, variant.Name)
+		if problem := checkOutputFile(variant.File); cfg.Outputs[variant.Name].File != "" && problem != "" {
+			v.addValueError(joinKey(key, "file"), "%s", problem)
+		}
+		for i, step := range variant.PostProcess {
+			if !slices.Contains(PostProcessSteps, step) {
+				v.addValueError(fmt.Sprintf("%s.postProcess[%d]", key, i), "invalid value %q, expected one of %s", step, strings.Join(PostProcessSteps, ", "))
+			}
+		}
+		if level := variant.MJML.ValidationLevel; level != "" && !slices.Contains(ValidationLevels, level) {
+			v.addValueError(joinKey(key, "mjml.validationLevel"), "invalid value %q, expected one of %s", level, strings.Join(ValidationLevels, ", "))
+		}
+
+		// Variants need distinct files, unless the pattern contains the variant name
+		if other, ok := files[variant.File]; ok && !strings.Contains(variant.File, "{variant}") {
+			v.addValueError(key, "writes to the same files as output %q, use {variant} in the file pattern", other)
+		}
+		files[variant.File] = variant.Name
+	}
+}
+
+// positionOf returns the position of a dotted key. Keys that are not set in the
+// config are reported for the config file.
+func (v *validator) positionOf(key string) Position {
+	if pos, ok := v.positions[key]; ok {
+		return pos
+	}
+	return Position{File: v.file}
+}
+
+// addValueError reports an error at the position of a dotted key.
+func (v *validator) addValueError(key, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{
+		Position: v.positionOf(key),
+		Key:      key,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// ValidateConfig loads the config like LoadConfig and additionally checks the
+// configured paths on disk. All errors point to their location in the config.
+func ValidateConfig(path string, opts ...Option) error {
+	config, v, err := newLoader(opts).load(path)
+	if err != nil {
+		return err
+	}
+
+	checkDir := func(key, path string, required bool) {
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			if required {
+				v.addValueError(key, "directory %q does not exist", path)
+			}
+		case err != nil:
+			v.addValueError(key, "%v", err)
+		case !info.IsDir():
+			v.addValueError(key, "%q is not a directory", path)
+		}
+	}
+
+	checkDir("paths.documents", config.Paths.Documents, true)
+	for _, dir := range config.Paths.Partials {
+		checkDir("paths.partials", dir.Path, true)
+	}
+	checkDir("paths.output", config.Paths.Output, false)
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// structFields returns the fields of a struct type by their YAML name.
+func structFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// suggest returns a hint for a misspelled field name.
+func suggest(name string, fields map[string]reflect.StructField) string {
+	candidates := make([]string, 0, len(fields))
+	for candidate := range fields {
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+
+	for _, candidate := range candidates {
+		if strings.EqualFold(name, candidate) || levenshtein(strings.ToLower(name), strings.ToLower(candidate)) <= 2 {
+			return fmt.Sprintf(", did you mean %q?", candidate)
+		}
+	}
+	return ""
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.DocumentNode, yaml.AliasNode:
+		return "an unexpected node"
+	case yaml.ScalarNode:
+		return fmt.Sprintf("%q", node.Value)
+	}
+	return "an unknown node"
+}
+
+func joinKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/friendsofgo/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// WorkspaceProject references the config of one project in a workspace.
+type WorkspaceProject struct {
+	// Name is used as URL prefix in the preview, defaults to the directory of the config
+	Name string `yaml:"name"`
+	// Config is the path of the project config, relative to the workspace file
+	Config string `yaml:"config"`
+}
+
+// Workspace groups several projects that are built and served together.
+type Workspace struct {
+	Projects []WorkspaceProject `yaml:"projects"`
+}
+
+// Project is a loaded project of a workspace.
+type Project struct {
+	Name   string
+	Config *Config
+}
+
+var ErrInvalidWorkspace = errors.New("invalid workspace")
+
+// LoadWorkspace loads a workspace file and the configs of all its projects. The
+// options are applied to every project config.
+func LoadWorkspace(path string, opts ...Option) ([]Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading workspace file")
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrapf(err, "unmarshalling workspace %s", path)
+	}
+	if len(doc.Content) == 0 {
+		return nil, errors.Wrapf(ErrInvalidWorkspace, "%s: no projects defined", path)
+	}
+
+	root := doc.Content[0]
+	v := &validator{
+		file:      path,
+		origins:   make(map[*yaml.Node]string),
+		positions: make(map[string]Position),
+	}
+	recordOrigin(v.origins, root, path)
+	v.checkNode(root, reflect.TypeOf(Workspace{}), "")
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+
+	var workspace Workspace
+	if err := root.Decode(&workspace); err != nil {
+		return nil, errors.Wrapf(err, "unmarshalling workspace %s", path)
+	}
+
+	projects := make([]Project, 0, len(workspace.Projects))
+	names := make(map[string]bool)
+	for i, wp := range workspace.Projects {
+		if wp.Config == "" {
+			return nil, errors.Wrapf(ErrInvalidWorkspace, "%s: projects[%d]: config is required", path, i)
+		}
+
+		configPath := wp.Config
+		if !filepath.IsAbs(configPath) {
+			configPath = filepath.Join(filepath.Dir(path), configPath)
+		}
+
+		name := wp.Name
+		if name == "" {
+			name = filepath.Base(filepath.Dir(configPath))
+		}
+		if strings.ContainsAny(name, "/\\") || strings.HasPrefix(name, "_") || name == "." {
+			return nil, errors.Wrapf(ErrInvalidWorkspace, "%s: invalid project name %q", path, name)
+		}
+		if names[name] {
+			return nil, errors.Wrapf(ErrInvalidWorkspace, "%s: duplicate project name %q", path, name)
+		}
+		names[name] = true
+
+		cfg, err := LoadConfig(configPath, opts...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading project %s", name)
+		}
+
+		projects = append(projects, Project{
+			Name:   name,
+			Config: cfg,
+		})
+	}
+
+	if len(projects) == 0 {
+		return nil, errors.Wrapf(ErrInvalidWorkspace, "%s: no projects defined", path)
+	}
+
+	return projects, nil
+}
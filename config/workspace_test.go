@@ -0,0 +1,83 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+func TestLoadWorkspace(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"transactional/envelopr.yaml": `
+paths:
+  documents: templates
+  partials: partials
+  output: dist
+`,
+		"marketing/envelopr.yaml": `
+paths:
+  output: /var/www/marketing
+`,
+		"envelopr.workspace.yaml": `
+projects:
+  - config: transactional/envelopr.yaml
+  - name: newsletters
+    config: marketing/envelopr.yaml
+`,
+		"duplicate.yaml": `
+projects:
+  - config: transactional/envelopr.yaml
+  - config: transactional/envelopr.yaml
+`,
+		"unknown.yaml": `
+project:
+  - config: transactional/envelopr.yaml
+`,
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	t.Run("projects", func(t *testing.T) {
+		r := require.New(t)
+
+		projects, err := config.LoadWorkspace(filepath.Join(tmpDir, "envelopr.workspace.yaml"))
+		r.NoError(err)
+		r.Len(projects, 2)
+
+		r.Equal("transactional", projects[0].Name)
+		r.Equal(filepath.Join(tmpDir, "transactional/templates"), projects[0].Config.Paths.Documents)
+		r.Equal(config.PartialDirs{{Path: filepath.Join(tmpDir, "transactional/partials")}}, projects[0].Config.Paths.Partials)
+		r.Equal(filepath.Join(tmpDir, "transactional/dist"), projects[0].Config.Paths.Output)
+
+		r.Equal("newsletters", projects[1].Name)
+		r.Equal(filepath.Join(tmpDir, "marketing/documents"), projects[1].Config.Paths.Documents)
+		r.Equal("/var/www/marketing", projects[1].Config.Paths.Output)
+	})
+
+	t.Run("duplicate project names", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := config.LoadWorkspace(filepath.Join(tmpDir, "duplicate.yaml"))
+		r.ErrorIs(err, config.ErrInvalidWorkspace)
+	})
+
+	t.Run("unknown fields", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := config.LoadWorkspace(filepath.Join(tmpDir, "unknown.yaml"))
+		var validationErrs config.ValidationErrors
+		r.ErrorAs(err, &validationErrs)
+		r.Equal("project", validationErrs[0].Key)
+	})
+}
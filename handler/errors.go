@@ -15,6 +15,8 @@ const (
 	ErrorRendering
 	ErrorCompiling
 	ErrorSaving
+	// ErrorLimitExceeded is reported for documents exceeding the render limits
+	ErrorLimitExceeded
 )
 
 func (e *Error) Error() string {
@@ -27,6 +29,8 @@ func (e *Error) Error() string {
 		return fmt.Sprintf("error compiling document '%s': %v", e.Doc, e.Wrapped)
 	case ErrorSaving:
 		return fmt.Sprintf("error saving document '%s': %v", e.Doc, e.Wrapped)
+	case ErrorLimitExceeded:
+		return fmt.Sprintf("limit exceeded rendering document '%s': %v", e.Doc, e.Wrapped)
 	default:
 		return fmt.Sprintf("unknown error: %v", e.Wrapped)
 	}
@@ -1,28 +1,65 @@
 package handler
 
 import (
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/friendsofgo/errors"
 
+	"github.com/esdete2/envelopr/config"
 	"github.com/esdete2/envelopr/template"
 )
 
 type FileLoader struct {
 	documentsPath string
-	partialsPath  string
+	partialDirs   config.PartialDirs
+	extensions    config.ExtensionsConfig
+	stylesPath    string
 }
 
+// LocalPartialsDir is the name of the directories next to documents holding
+// local partials. Files prefixed with "_" are local partials as well.
+const LocalPartialsDir = "_partials"
+
+// StyleExtension is the extension of the files in the styles directory.
+const StyleExtension = ".css"
+
 var ErrTemplateNotFound = errors.New("template not found")
 var ErrDirectoryNotFound = errors.New("directory not found")
+var ErrDuplicateTemplate = errors.New("duplicate template")
+
+type FileLoaderOption func(*FileLoader)
+
+// WithExtensions sets the extensions of documents and partials, .mjml is used
+// by default.
+func WithExtensions(extensions config.ExtensionsConfig) FileLoaderOption {
+	return func(l *FileLoader) {
+		l.extensions = extensions
+	}
+}
+
+// WithStyles sets the directory of the CSS files included by templates.
+func WithStyles(stylesPath string) FileLoaderOption {
+	return func(l *FileLoader) {
+		l.stylesPath = stylesPath
+	}
+}
 
-func NewFileLoader(documentsPath, partialsPath string) *FileLoader {
-	return &FileLoader{
+// NewFileLoader creates a loader for the documents and partial directories. If
+// the same partial name is found in several directories, the partial of the
+// earlier directory is used.
+func NewFileLoader(documentsPath string, partialDirs config.PartialDirs, opts ...FileLoaderOption) *FileLoader {
+	loader := &FileLoader{
 		documentsPath: documentsPath,
-		partialsPath:  partialsPath,
+		partialDirs:   partialDirs,
 	}
+	for _, opt := range opts {
+		opt(loader)
+	}
+	return loader
 }
 
 func (l *FileLoader) LoadDocuments() ([]template.Template, error) {
@@ -30,7 +67,16 @@ func (l *FileLoader) LoadDocuments() ([]template.Template, error) {
 		return nil, nil
 	}
 
-	return l.loadTemplates(l.documentsPath)
+	documents, err := l.loadTemplates(l.documentsPath, l.extensions.DocumentExtensions())
+	if err != nil {
+		return nil, err
+	}
+
+	// Local partials are no documents
+	return slices.DeleteFunc(documents, func(doc template.Template) bool {
+		_, _, ok := localPartial(doc.Name)
+		return ok
+	}), nil
 }
 
 func (l *FileLoader) LoadDocument(name string) ([]template.Template, error) {
@@ -38,60 +84,241 @@ func (l *FileLoader) LoadDocument(name string) ([]template.Template, error) {
 		return nil, nil
 	}
 
-	// Handle both with and without .mjml extension
-	if !strings.HasSuffix(name, ".mjml") {
-		name += ".mjml"
+	// Handle names with and without extension
+	name = filepath.ToSlash(name)
+	if _, _, ok := localPartial(name); ok {
+		return nil, errors.Wrapf(ErrTemplateNotFound, "template: %s is a local partial", name)
+	}
+	fileNames := []string{name}
+	if _, _, ok := config.TrimExtension(name, l.extensions.DocumentExtensions()); !ok {
+		fileNames = fileNames[:0]
+		for _, ext := range l.extensions.DocumentExtensions() {
+			fileNames = append(fileNames, name+ext)
+		}
 	}
 
-	// Build the full path
-	fullPath := filepath.Join(l.documentsPath, name)
+	for _, fileName := range fileNames {
+		// Build the full path
+		fullPath := filepath.Join(l.documentsPath, filepath.FromSlash(fileName))
 
-	// Check if file exists
-	if _, err := os.Stat(fullPath); err != nil {
-		if os.IsNotExist(err) {
-			return nil, errors.Wrapf(ErrTemplateNotFound, "template: %s", name)
+		// Check if file exists
+		if _, err := os.Stat(fullPath); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrap(err, "checking template file")
 		}
-		return nil, errors.Wrap(err, "checking template file")
+
+		// Read the file
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading template file")
+		}
+
+		// Create template
+		docName, ext, _ := config.TrimExtension(fileName, l.extensions.DocumentExtensions())
+		tmpl, err := l.newTemplate(docName, fullPath, ext, content)
+		if err != nil {
+			return nil, err
+		}
+		return []template.Template{tmpl}, nil
+	}
+
+	return nil, errors.Wrapf(ErrTemplateNotFound, "template: %s", name)
+}
+
+// ListDocuments returns the names of all documents without reading their content.
+func (l *FileLoader) ListDocuments() ([]string, error) {
+	if l.documentsPath == "" {
+		return nil, nil
 	}
 
-	// Read the file
-	content, err := os.ReadFile(fullPath)
+	names := make([]string, 0)
+	err := walkTemplates(l.documentsPath, l.extensions.DocumentExtensions(), func(name, _, _ string) error {
+		if _, _, ok := localPartial(name); !ok {
+			names = append(names, name)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "reading template file")
+		return nil, err
 	}
 
-	// Create template
-	name = strings.TrimSuffix(filepath.ToSlash(name), ".mjml")
-	return []template.Template{{
-		Name:    name,
-		Content: string(content),
-	}}, nil
+	return names, nil
 }
 
+// LoadPartials loads the partials of all partial directories. Partials of a
+// directory with namespace are prefixed with the namespace.
 func (l *FileLoader) LoadPartials() ([]template.Template, error) {
-	if l.partialsPath == "" {
+	if len(l.partialDirs) == 0 {
+		return nil, nil
+	}
+
+	partials := make([]template.Template, 0)
+	paths := make(map[string]string)
+	for _, dir := range l.partialDirs {
+		templates, err := l.loadTemplates(dir.Path, l.extensions.PartialExtensions())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tmpl := range templates {
+			tmpl.Name = dir.TemplateName(tmpl.Name)
+
+			// Earlier directories take precedence
+			if other, exists := paths[tmpl.Name]; exists {
+				slog.Debug("Partial is shadowed by an earlier directory", "partial", tmpl.Name, "path", tmpl.Path, "shadowedBy", other)
+				continue
+			}
+			paths[tmpl.Name] = tmpl.Path
+			partials = append(partials, tmpl)
+		}
+	}
+
+	return partials, nil
+}
+
+// LoadStyles loads the CSS files of the styles directory by name, the path
+// relative to the directory without extension. A missing directory has no
+// styles.
+func (l *FileLoader) LoadStyles() (map[string]string, error) {
+	if l.stylesPath == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(l.stylesPath); os.IsNotExist(err) {
 		return nil, nil
 	}
 
-	return l.loadTemplates(l.partialsPath)
+	styles := make(map[string]string)
+	err := walkTemplates(l.stylesPath, []string{StyleExtension}, func(name, path, _ string) error {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "reading file")
+		}
+		styles[name] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return styles, nil
 }
 
-func (l *FileLoader) loadTemplates(dir string) ([]template.Template, error) {
-	// Check if directory exists
-	if _, err := os.Stat(dir); err != nil {
-		if os.IsNotExist(err) {
-			return nil, errors.Wrapf(ErrDirectoryNotFound, "directory: %s", dir)
+// LoadLocalPartials loads the partials inside the documents directory, either
+// from _partials directories or from files prefixed with "_". They are only
+// visible to the documents next to them and in subdirectories.
+func (l *FileLoader) LoadLocalPartials() ([]template.Template, error) {
+	if l.documentsPath == "" {
+		return nil, nil
+	}
+
+	templates, err := l.loadTemplates(l.documentsPath, l.extensions.PartialExtensions())
+	if err != nil {
+		return nil, err
+	}
+
+	partials := make([]template.Template, 0)
+	paths := make(map[string]string)
+	for _, tmpl := range templates {
+		name, scope, ok := localPartial(tmpl.Name)
+		if !ok {
+			continue
+		}
+
+		// Partials of the same name may only exist in different directories
+		key := scope + ":" + name
+		if other, exists := paths[key]; exists {
+			return nil, errors.Wrapf(ErrDuplicateTemplate, "%s: %s and %s", name, other, tmpl.Path)
 		}
-		return nil, errors.Wrap(err, "checking directory")
+		paths[key] = tmpl.Path
+
+		tmpl.Name = name
+		tmpl.Local = true
+		tmpl.Scope = scope
+		partials = append(partials, tmpl)
 	}
 
+	return partials, nil
+}
+
+func (l *FileLoader) loadTemplates(dir string, extensions []string) ([]template.Template, error) {
 	templates := make([]template.Template, 0)
+	paths := make(map[string]string)
+
+	err := walkTemplates(dir, extensions, func(name, path, ext string) error {
+		if other, exists := paths[name]; exists {
+			return errors.Wrapf(ErrDuplicateTemplate, "%s: %s and %s", name, other, path)
+		}
+		paths[name] = path
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		content, err := os.ReadFile(path)
 		if err != nil {
-			return errors.Wrap(err, "walking directory")
+			return errors.Wrap(err, "reading file")
+		}
+
+		tmpl, err := l.newTemplate(name, path, ext, content)
+		if err != nil {
+			return err
+		}
+		templates = append(templates, tmpl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// newTemplate creates a template from the content of a file, splitting off its
+// front matter. Documents with an HTML extension skip MJML compilation.
+func (l *FileLoader) newTemplate(name, path, ext string, content []byte) (template.Template, error) {
+	frontMatter, body, err := template.ParseFrontMatter(string(content))
+	if err != nil {
+		return template.Template{}, errors.Wrapf(err, "parsing %s", path)
+	}
+
+	return template.Template{
+		Name:        name,
+		Path:        path,
+		Content:     body,
+		FrontMatter: frontMatter,
+		HTML:        l.extensions.IsHTML(ext),
+	}, nil
+}
+
+// localPartial reports whether the template with the given path relative to
+// the documents directory is a local partial. It returns the partial name and
+// the directory the partial is visible in.
+func localPartial(relPath string) (string, string, bool) {
+	segments := strings.Split(relPath, "/")
+	for i, segment := range segments[:len(segments)-1] {
+		if segment == LocalPartialsDir {
+			return strings.Join(segments[i+1:], "/"), strings.Join(segments[:i], "/"), true
+		}
+	}
+
+	if base := segments[len(segments)-1]; strings.HasPrefix(base, "_") {
+		return strings.TrimPrefix(base, "_"), strings.Join(segments[:len(segments)-1], "/"), true
+	}
+
+	return "", "", false
+}
+
+// walkTemplates calls fn with the name, path and extension of every template
+// file in dir with one of the extensions.
+func walkTemplates(dir string, extensions []string, fn func(name, path, ext string) error) error {
+	// Check if directory exists
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return errors.Wrapf(ErrDirectoryNotFound, "directory: %s", dir)
 		}
-		if info.IsDir() || filepath.Ext(path) != ".mjml" {
+		return errors.Wrap(err, "checking directory")
+	}
+
+	err := walkFiles(dir, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
 			return nil
 		}
 
@@ -100,23 +327,64 @@ func (l *FileLoader) loadTemplates(dir string) ([]template.Template, error) {
 			return errors.Wrap(err, "getting relative path")
 		}
 
-		name := strings.TrimSuffix(filepath.ToSlash(relPath), ".mjml")
-
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return errors.Wrap(err, "reading file")
+		name, ext, ok := config.TrimExtension(filepath.ToSlash(relPath), extensions)
+		if !ok {
+			return nil
 		}
 
-		templates = append(templates, template.Template{
-			Name:    name,
-			Content: string(content),
-		})
-		return nil
+		return fn(name, path, ext)
 	})
 
 	if err != nil {
-		return nil, errors.Wrap(err, "walking directory for templates")
+		return errors.Wrap(err, "walking directory for templates")
 	}
 
-	return templates, nil
+	return nil
+}
+
+// walkFiles calls fn for root and every directory and file below it in lexical
+// order. Unlike filepath.Walk it follows symbolic links, directories that were
+// already visited through another link are skipped. Broken links are ignored.
+func walkFiles(root string, fn func(path string, info os.FileInfo) error) error {
+	visited := make(map[string]bool)
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) && path != root {
+				return nil
+			}
+			return errors.Wrap(err, "walking directory")
+		}
+		if !info.IsDir() {
+			return fn(path, info)
+		}
+
+		realPath, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return errors.Wrap(err, "resolving directory")
+		}
+		if visited[realPath] {
+			return nil
+		}
+		visited[realPath] = true
+
+		if err := fn(path, info); err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return errors.Wrap(err, "walking directory")
+		}
+		for _, entry := range entries {
+			if err := walk(filepath.Join(path, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return walk(root)
 }
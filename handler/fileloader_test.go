@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/esdete2/envelopr/config"
 	"github.com/esdete2/envelopr/handler"
 )
 
@@ -14,7 +15,7 @@ func TestFileLoader_LoadDocuments(t *testing.T) {
 	t.Run("empty directory path", func(t *testing.T) {
 		r := require.New(t)
 
-		loader := handler.NewFileLoader("", "")
+		loader := handler.NewFileLoader("", nil)
 		docs, err := loader.LoadDocuments()
 		r.NoError(err)
 		r.Nil(docs)
@@ -23,7 +24,7 @@ func TestFileLoader_LoadDocuments(t *testing.T) {
 	t.Run("non-existent directory", func(t *testing.T) {
 		r := require.New(t)
 
-		loader := handler.NewFileLoader("/does/not/exist", "")
+		loader := handler.NewFileLoader("/does/not/exist", nil)
 		_, err := loader.LoadDocuments()
 		r.Error(err)
 		r.Contains(err.Error(), handler.ErrDirectoryNotFound.Error())
@@ -37,7 +38,7 @@ func TestFileLoader_LoadDocuments(t *testing.T) {
 		r.NoError(err)
 		defer os.RemoveAll(tmpDir)
 
-		loader := handler.NewFileLoader(tmpDir, "")
+		loader := handler.NewFileLoader(tmpDir, nil)
 		docs, err := loader.LoadDocuments()
 		r.NoError(err)
 		r.Empty(docs)
@@ -64,7 +65,7 @@ func TestFileLoader_LoadDocuments(t *testing.T) {
 			r.NoError(err)
 		}
 
-		loader := handler.NewFileLoader(tmpDir, "")
+		loader := handler.NewFileLoader(tmpDir, nil)
 		docs, err := loader.LoadDocuments()
 		r.NoError(err)
 		r.Len(docs, 2) // Only .mjml files
@@ -78,12 +79,34 @@ func TestFileLoader_LoadDocuments(t *testing.T) {
 		r.Equal("<mjml>1</mjml>", docMap["welcome"])
 		r.Equal("<mjml>2</mjml>", docMap["marketing/newsletter"])
 	})
+
+	t.Run("front matter", func(t *testing.T) {
+		r := require.New(t)
+
+		tmpDir, err := os.MkdirTemp("", "envelopr-test")
+		r.NoError(err)
+		defer os.RemoveAll(tmpDir)
+
+		path := filepath.Join(tmpDir, "welcome.mjml")
+		r.NoError(os.WriteFile(path, []byte("---\nmjml:\n  validationLevel: strict\n---\n<mjml></mjml>"), 0644))
+
+		loader := handler.NewFileLoader(tmpDir, nil)
+		docs, err := loader.LoadDocument("welcome")
+		r.NoError(err)
+		r.Len(docs, 1)
+		r.Equal("strict", docs[0].FrontMatter.MJML.ValidationLevel)
+		r.NotContains(docs[0].Content, "validationLevel")
+
+		r.NoError(os.WriteFile(path, []byte("---\nmjml:\n  validation: strict\n---\n<mjml></mjml>"), 0644))
+		_, err = loader.LoadDocuments()
+		r.ErrorContains(err, path)
+	})
 }
 func TestFileLoader_LoadPartials(t *testing.T) {
 	t.Run("empty directory path", func(t *testing.T) {
 		r := require.New(t)
 
-		loader := handler.NewFileLoader("", "")
+		loader := handler.NewFileLoader("", nil)
 		partials, err := loader.LoadPartials()
 		r.NoError(err)
 		r.Nil(partials)
@@ -92,7 +115,7 @@ func TestFileLoader_LoadPartials(t *testing.T) {
 	t.Run("non-existent directory", func(t *testing.T) {
 		r := require.New(t)
 
-		loader := handler.NewFileLoader("", "/does/not/exist")
+		loader := handler.NewFileLoader("", config.PartialDirs{{Path: "/does/not/exist"}})
 		_, err := loader.LoadPartials()
 		r.Error(err)
 		r.Contains(err.Error(), handler.ErrDirectoryNotFound.Error())
@@ -105,7 +128,7 @@ func TestFileLoader_LoadPartials(t *testing.T) {
 		r.NoError(err)
 		defer os.RemoveAll(tmpDir)
 
-		loader := handler.NewFileLoader("", tmpDir)
+		loader := handler.NewFileLoader("", config.PartialDirs{{Path: tmpDir}})
 		partials, err := loader.LoadPartials()
 		r.NoError(err)
 		r.Empty(partials)
@@ -132,7 +155,7 @@ func TestFileLoader_LoadPartials(t *testing.T) {
 			r.NoError(err)
 		}
 
-		loader := handler.NewFileLoader("", tmpDir)
+		loader := handler.NewFileLoader("", config.PartialDirs{{Path: tmpDir}})
 		partials, err := loader.LoadPartials()
 		r.NoError(err)
 		r.Len(partials, 2) // Only .mjml files
@@ -146,3 +169,181 @@ func TestFileLoader_LoadPartials(t *testing.T) {
 		r.Equal("<mj-section>footer</mj-section>", partialsMap["shared/footer"])
 	})
 }
+
+func TestFileLoader_Extensions(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	r.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	docsDir := filepath.Join(tmpDir, "documents")
+	partialsDir := filepath.Join(tmpDir, "partials")
+
+	files := map[string]string{
+		"documents/welcome.mjml.tmpl":   "<mjml>welcome</mjml>",
+		"documents/legacy/order.gohtml": "<html>order</html>",
+		"documents/ignored.mjml":        "<mjml>ignored</mjml>",
+		"partials/header.mjml":          "<mj-section>header</mj-section>",
+		"partials/tracking.html":        "<img src=\"pixel.gif\">",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(tmpDir, path)
+		r.NoError(os.MkdirAll(filepath.Dir(fullPath), 0755))
+		r.NoError(os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	loader := handler.NewFileLoader(docsDir, config.PartialDirs{{Path: partialsDir}}, handler.WithExtensions(config.ExtensionsConfig{
+		Documents: []string{".mjml.tmpl"},
+		Partials:  []string{".mjml", ".html"},
+		HTML:      []string{".gohtml"},
+	}))
+
+	docs, err := loader.LoadDocuments()
+	r.NoError(err)
+	r.Len(docs, 2)
+	docMap := make(map[string]bool)
+	for _, doc := range docs {
+		docMap[doc.Name] = doc.HTML
+	}
+	r.Equal(map[string]bool{"welcome": false, "legacy/order": true}, docMap)
+
+	partials, err := loader.LoadPartials()
+	r.NoError(err)
+	r.Len(partials, 2)
+
+	docs, err = loader.LoadDocument("legacy/order")
+	r.NoError(err)
+	r.Equal("legacy/order", docs[0].Name)
+	r.True(docs[0].HTML)
+
+	docs, err = loader.LoadDocument("welcome.mjml.tmpl")
+	r.NoError(err)
+	r.Equal("welcome", docs[0].Name)
+
+	_, err = loader.LoadDocument("ignored")
+	r.ErrorIs(err, handler.ErrTemplateNotFound)
+
+	// Documents that only differ in extension are ambiguous
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "welcome.gohtml"), []byte("<html></html>"), 0644))
+	_, err = loader.LoadDocuments()
+	r.ErrorIs(err, handler.ErrDuplicateTemplate)
+}
+
+func TestFileLoader_PartialDirs(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	r.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"partials/header.mjml":           "<mj-section>project header</mj-section>",
+		"shared/header.mjml":             "<mj-section>shared header</mj-section>",
+		"shared/footer.mjml":             "<mj-section>shared footer</mj-section>",
+		"library/components/button.mjml": "<mj-button>brand</mj-button>",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(tmpDir, path)
+		r.NoError(os.MkdirAll(filepath.Dir(fullPath), 0755))
+		r.NoError(os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	// The brand library is linked into the project
+	r.NoError(os.Symlink(filepath.Join(tmpDir, "library"), filepath.Join(tmpDir, "brand")))
+
+	loader := handler.NewFileLoader("", config.PartialDirs{
+		{Path: filepath.Join(tmpDir, "partials")},
+		{Path: filepath.Join(tmpDir, "shared")},
+		{Path: filepath.Join(tmpDir, "brand"), Namespace: "brand"},
+	})
+	partials, err := loader.LoadPartials()
+	r.NoError(err)
+
+	partialsMap := make(map[string]string)
+	for _, partial := range partials {
+		partialsMap[partial.Name] = partial.Content
+	}
+	r.Equal(map[string]string{
+		"header":                  "<mj-section>project header</mj-section>", // earlier directory wins
+		"footer":                  "<mj-section>shared footer</mj-section>",
+		"brand/components/button": "<mj-button>brand</mj-button>",
+	}, partialsMap)
+}
+
+func TestFileLoader_LocalPartials(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	r.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"welcome.mjml":                       "<mjml></mjml>",
+		"_footer.mjml":                       "<mj-section>footer</mj-section>",
+		"campaign/launch.mjml":               "<mjml></mjml>",
+		"campaign/_partials/header.mjml":     "<mj-section>campaign header</mj-section>",
+		"campaign/_partials/blocks/cta.mjml": "<mj-button>cta</mj-button>",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(tmpDir, path)
+		r.NoError(os.MkdirAll(filepath.Dir(fullPath), 0755))
+		r.NoError(os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	loader := handler.NewFileLoader(tmpDir, nil)
+
+	documents, err := loader.LoadDocuments()
+	r.NoError(err)
+	names := make([]string, 0, len(documents))
+	for _, doc := range documents {
+		names = append(names, doc.Name)
+	}
+	r.ElementsMatch([]string{"welcome", "campaign/launch"}, names)
+
+	listed, err := loader.ListDocuments()
+	r.NoError(err)
+	r.ElementsMatch([]string{"welcome", "campaign/launch"}, listed)
+
+	_, err = loader.LoadDocument("campaign/_partials/header")
+	r.ErrorIs(err, handler.ErrTemplateNotFound)
+
+	partials, err := loader.LoadLocalPartials()
+	r.NoError(err)
+	scopes := make(map[string]string)
+	for _, partial := range partials {
+		r.True(partial.Local)
+		scopes[partial.Name] = partial.Scope
+	}
+	r.Equal(map[string]string{
+		"footer":     "",
+		"header":     "campaign",
+		"blocks/cta": "campaign",
+	}, scopes)
+
+	// The same partial in a _partials directory and as prefixed file is ambiguous
+	r.NoError(os.WriteFile(filepath.Join(tmpDir, "campaign", "_header.mjml"), []byte("<mj-section></mj-section>"), 0644))
+	_, err = loader.LoadLocalPartials()
+	r.ErrorIs(err, handler.ErrDuplicateTemplate)
+}
+
+func TestFileLoader_LoadStyles(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir := t.TempDir()
+	r.NoError(os.MkdirAll(filepath.Join(tmpDir, "themes"), 0755))
+	r.NoError(os.WriteFile(filepath.Join(tmpDir, "utilities.css"), []byte(".center { text-align: center; }"), 0644))
+	r.NoError(os.WriteFile(filepath.Join(tmpDir, "themes", "dark.css"), []byte("@media (prefers-color-scheme: dark) {}"), 0644))
+	r.NoError(os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("not a stylesheet"), 0644))
+
+	styles, err := handler.NewFileLoader("", nil, handler.WithStyles(tmpDir)).LoadStyles()
+	r.NoError(err)
+	r.Equal(map[string]string{
+		"utilities":   ".center { text-align: center; }",
+		"themes/dark": "@media (prefers-color-scheme: dark) {}",
+	}, styles)
+
+	styles, err = handler.NewFileLoader("", nil, handler.WithStyles(filepath.Join(tmpDir, "missing"))).LoadStyles()
+	r.NoError(err)
+	r.Nil(styles)
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/friendsofgo/errors"
+
+	"github.com/esdete2/envelopr/config"
+	"github.com/esdete2/envelopr/template"
+)
+
+// headTemplate joins the head fragments of the config to the template added to
+// the mj-head of the documents. Partials are called with the data of the
+// document, stylesheets are included like the files of the styles directory.
+func headTemplate(fragments []config.HeadFragment) string {
+	var b strings.Builder
+	for _, fragment := range fragments {
+		switch {
+		case fragment.MJML != "":
+			b.WriteString(fragment.MJML)
+		case fragment.Partial != "":
+			fmt.Fprintf(&b, "{{ template %q . }}", fragment.Partial)
+		case fragment.CSS != "":
+			b.WriteString(template.HeadStylesheet(fragment.CSS, fragment.Inline))
+		}
+	}
+	return b.String()
+}
+
+// loadHeadStyles adds the stylesheets of the head fragments to styles, named by
+// template.HeadStyle. The files are read on every build.
+func loadHeadStyles(styles map[string]string, fragments []config.HeadFragment) (map[string]string, error) {
+	for _, fragment := range fragments {
+		if fragment.CSS == "" {
+			continue
+		}
+		css, err := os.ReadFile(fragment.CSS)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading head stylesheet")
+		}
+		if styles == nil {
+			styles = make(map[string]string)
+		}
+		styles[template.HeadStyle(fragment.CSS)] = string(css)
+	}
+	return styles, nil
+}
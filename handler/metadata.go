@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"cmp"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/friendsofgo/errors"
+
+	"github.com/esdete2/envelopr/config"
+	"github.com/esdete2/envelopr/template"
+)
+
+// MetadataKey is the reserved key of the build metadata in the template data.
+const MetadataKey = "Envelopr"
+
+// Metadata is injected into the template data of every document as .Envelopr.
+type Metadata struct {
+	// Name of the document, e.g. "shop/invoice"
+	Name string
+	// Path of the document source relative to the documents directory
+	Path string
+	// BuildTime is the time of the build, see config.BuildConfig.Time
+	BuildTime time.Time
+	// Commit is the git commit of the build, see config.BuildConfig.Commit
+	Commit string
+	// Profile is the active config profile
+	Profile string
+	// Locale of the document
+	Locale string
+	// Env contains the allow-listed environment variables
+	Env map[string]string
+}
+
+// newBuildMetadata collects the metadata shared by all documents of a build.
+func newBuildMetadata(cfg *config.Config, commit string) (Metadata, error) {
+	buildTime, err := resolveBuildTime(cfg.Build.Time)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	// Restricted templates have no access to the environment
+	env := make(map[string]string, len(cfg.Build.Env))
+	if cfg.Template.Restricted && len(cfg.Build.Env) > 0 {
+		slog.Warn("Environment variables are not exposed to restricted templates", "env", cfg.Build.Env)
+	} else {
+		for _, name := range cfg.Build.Env {
+			if val, ok := os.LookupEnv(name); ok {
+				env[name] = val
+			}
+		}
+	}
+
+	return Metadata{
+		BuildTime: buildTime,
+		Commit:    commit,
+		Profile:   cfg.Profile,
+		Locale:    cfg.Template.Locale,
+		Env:       env,
+	}, nil
+}
+
+// forDocument returns a copy of the build metadata for a single document.
+func (m Metadata) forDocument(doc template.Template, documentsPath string, data map[string]any) Metadata {
+	m.Name = doc.Name
+	m.Path = doc.Path
+	if relPath, err := filepath.Rel(documentsPath, doc.Path); err == nil {
+		m.Path = filepath.ToSlash(relPath)
+	}
+
+	// Documents can set their locale through their variables
+	if locale, ok := data["locale"].(string); ok && locale != "" {
+		m.Locale = locale
+	}
+
+	return m
+}
+
+// resolveBuildTime uses the configured time, then SOURCE_DATE_EPOCH and falls
+// back to the current time.
+func resolveBuildTime(configured string) (time.Time, error) {
+	if configured != "" {
+		t, err := time.Parse(time.RFC3339, configured)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "parsing build time")
+		}
+		return t, nil
+	}
+
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "parsing SOURCE_DATE_EPOCH")
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	return time.Now(), nil
+}
+
+// buildCommit uses the configured commit and falls back to the git commit of
+// the config directory.
+func buildCommit(cfg *config.Config) string {
+	if cfg.Build.Commit != "" {
+		return cfg.Build.Commit
+	}
+	return gitCommit(cmp.Or(cfg.Dir, cfg.Paths.Documents))
+}
+
+func gitCommit(dir string) string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		slog.Debug("Could not determine git commit", "dir", dir)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"path"
+	"strings"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+// outputFile returns the output path of a document for an output variant,
+// relative to the output directory.
+func outputFile(pattern, name, locale, variant string) (string, error) {
+	dir := path.Dir(name)
+	if dir == "." {
+		dir = ""
+	}
+
+	return config.ExpandOutputFile(pattern, map[string]string{
+		"path":    name,
+		"dir":     dir,
+		"name":    path.Base(name),
+		"locale":  locale,
+		"variant": variant,
+	})
+}
+
+// postProcess applies the post-processing steps of an output variant to the
+// compiled HTML in order.
+func postProcess(html string, steps []string) string {
+	for _, step := range steps {
+		switch step {
+		case "trim":
+			html = strings.TrimSpace(html)
+		case "trimLines":
+			lines := strings.Split(html, "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimRight(line, " \t\r")
+			}
+			html = strings.Join(lines, "\n")
+		case "crlf":
+			html = strings.ReplaceAll(strings.ReplaceAll(html, "\r\n", "\n"), "\n", "\r\n")
+		}
+	}
+	return html
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"cmp"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/friendsofgo/errors"
 
@@ -11,20 +14,48 @@ import (
 	"github.com/esdete2/envelopr/template"
 )
 
+// relativeAssetsURL is the prefix of generated images without configured
+// assets URL. It is replaced by the path of the assets directory relative to
+// each output file, which depends on the output variant.
+const relativeAssetsURL = "envelopr-assets:"
+
 type Processor struct {
 	config   *config.Config
 	compiler *template.Compiler
+	// commit is resolved once, git is not run for every rebuild
+	commit string
+}
+
+// build holds the state shared by all documents processed in one run.
+type build struct {
+	renderer *template.Renderer
+	resolver *VariableResolver
+	metadata Metadata
 }
 
 func NewProcessor(cfg *config.Config) (*Processor, error) {
 	return &Processor{
 		config:   cfg,
 		compiler: template.NewCompiler(cfg),
+		commit:   buildCommit(cfg),
 	}, nil
 }
 
 func (p *Processor) Process() error {
-	loader := NewFileLoader(p.config.Paths.Documents, p.config.Paths.Partials)
+	return p.process(nil)
+}
+
+// ProcessStyle processes the documents including the stylesheet.
+func (p *Processor) ProcessStyle(style string) error {
+	return p.process(func(renderer *template.Renderer, doc template.Template) (bool, error) {
+		return renderer.UsesStyle(doc.Name, style)
+	})
+}
+
+// process processes the documents selected by include, or all documents if it
+// is nil.
+func (p *Processor) process(include func(*template.Renderer, template.Template) (bool, error)) error {
+	loader := p.newFileLoader()
 
 	documents, err := loader.LoadDocuments()
 	if err != nil {
@@ -34,17 +65,11 @@ func (p *Processor) Process() error {
 		}
 	}
 
-	partials, err := loader.LoadPartials()
+	partials, err := loadPartials(loader)
 	if err != nil {
-		return &Error{
-			Type:    ErrorLoadingFiles,
-			Wrapped: errors.Wrap(err, "loading partials"),
-		}
+		return err
 	}
 
-	// Create renderer with fresh templates
-	renderer := template.NewRenderer(documents, partials)
-
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(p.config.Paths.Output, 0755); err != nil {
 		return &Error{
@@ -53,9 +78,33 @@ func (p *Processor) Process() error {
 		}
 	}
 
+	names := make([]string, 0, len(documents))
+	for _, doc := range documents {
+		names = append(names, doc.Name)
+	}
+
+	// Create renderer with fresh templates
+	b, err := p.newBuild(loader, documents, partials, names)
+	if err != nil {
+		return err
+	}
+
 	// Process all documents
-	for _, doc := range renderer.Documents() {
-		if err := p.processDocument(doc, renderer); err != nil {
+	for _, doc := range b.renderer.Documents() {
+		if include != nil {
+			ok, err := include(b.renderer, doc)
+			if err != nil {
+				return &Error{
+					Type:    ErrorRendering,
+					Doc:     doc.Name,
+					Wrapped: err,
+				}
+			}
+			if !ok {
+				continue
+			}
+		}
+		if err := p.processDocument(doc, b); err != nil {
 			return errors.Wrap(err, "processing document")
 		}
 	}
@@ -64,7 +113,7 @@ func (p *Processor) Process() error {
 }
 
 func (p *Processor) ProcessSingle(templateName string) error {
-	loader := NewFileLoader(p.config.Paths.Documents, p.config.Paths.Partials)
+	loader := p.newFileLoader()
 
 	// Load just the specified document
 	documents, err := loader.LoadDocument(templateName)
@@ -84,68 +133,270 @@ func (p *Processor) ProcessSingle(templateName string) error {
 	}
 
 	// Always load all partials since they might be used
-	partials, err := loader.LoadPartials()
+	partials, err := loadPartials(loader)
+	if err != nil {
+		return err
+	}
+
+	// Variable rules depend on all document names, not only the one being built
+	names, err := loader.ListDocuments()
 	if err != nil {
 		return &Error{
 			Type:    ErrorLoadingFiles,
-			Wrapped: errors.Wrap(err, "loading partials"),
+			Wrapped: errors.Wrap(err, "listing documents"),
 		}
 	}
 
 	// Create renderer with fresh templates
-	renderer := template.NewRenderer(documents, partials)
+	b, err := p.newBuild(loader, documents, partials, names)
+	if err != nil {
+		return err
+	}
 
 	// Process the single document
-	return p.processDocument(documents[0], renderer)
+	return p.processDocument(documents[0], b)
+}
+
+// Variables returns the effective template variables of a document.
+func (p *Processor) Variables(templateName string) (map[string]any, error) {
+	loader := p.newFileLoader()
+
+	names, err := loader.ListDocuments()
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorLoadingFiles,
+			Wrapped: errors.Wrap(err, "listing documents"),
+		}
+	}
+
+	templateName, _, _ = config.TrimExtension(filepath.ToSlash(templateName), p.config.Extensions.DocumentExtensions())
+	found := false
+	for _, name := range names {
+		if name == templateName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, &Error{
+			Type:    ErrorLoadingFiles,
+			Doc:     templateName,
+			Wrapped: errors.Wrapf(ErrTemplateNotFound, "template: %s", templateName),
+		}
+	}
+
+	return NewVariableResolver(p.config.Template, names).Resolve(templateName), nil
+}
+
+// loadPartials loads the global partials followed by the local partials next to
+// the documents.
+func loadPartials(loader *FileLoader) ([]template.Template, error) {
+	partials, err := loader.LoadPartials()
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorLoadingFiles,
+			Wrapped: errors.Wrap(err, "loading partials"),
+		}
+	}
+
+	local, err := loader.LoadLocalPartials()
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorLoadingFiles,
+			Wrapped: errors.Wrap(err, "loading local partials"),
+		}
+	}
+
+	return append(partials, local...), nil
 }
 
-func (p *Processor) processDocument(doc template.Template, renderer *template.Renderer) error {
-	// Prepare data
-	data := make(map[string]any)
+func (p *Processor) newFileLoader() *FileLoader {
+	return NewFileLoader(p.config.Paths.Documents, p.config.Paths.Partials,
+		WithExtensions(p.config.Extensions),
+		WithStyles(p.config.Paths.Styles),
+	)
+}
 
-	// Add global variables
-	for k, v := range p.config.Template.Variables {
-		data[k] = v
+func (p *Processor) newRenderer(documents, partials []template.Template, styles map[string]string, metadata Metadata) (*template.Renderer, error) {
+	location, err := time.LoadLocation(p.config.Template.Timezone)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading timezone")
 	}
 
-	// Add document-specific variables
-	parts := strings.Split(doc.Name, "/")
+	opts := []template.RendererOption{
+		template.WithDuplicates(p.config.Template.Duplicates),
+		template.WithEscape(p.config.Template.Escape),
+		template.WithLimits(template.Limits{
+			Timeout:       p.config.Template.Limits.TimeoutDuration(),
+			MaxOutputSize: p.config.Template.Limits.MaxOutputSize,
+			MaxDepth:      p.config.Template.Limits.MaxDepth,
+		}),
+		// Dates are formatted relative to the build time for reproducible builds
+		template.WithFormat(template.Format{
+			Locale:   p.config.Template.Locale,
+			Location: location,
+			Now:      metadata.BuildTime,
+		}),
+		template.WithAssets(template.Assets{
+			Dir: p.config.Paths.Assets,
+			URL: cmp.Or(p.config.Paths.AssetsURL, relativeAssetsURL),
+		}),
+		template.WithHead(headTemplate(p.config.MJML.Head)),
+		template.WithStyles(styles),
+		template.WithEvent(p.config.Template.Event),
+	}
+	if p.config.Template.Restricted {
+		opts = append(opts, template.WithRestricted())
+	}
+	return template.NewRenderer(documents, partials, opts...), nil
+}
 
-	if docVars, exists := p.config.Template.Documents[doc.Name]; exists {
-		data = mergeMaps(data, docVars)
-	} else if len(parts) > 1 {
-		// Handle nested structure (e.g., "shop/invoice")
-		if parentVars, exists := p.config.Template.Documents[parts[0]]; exists {
-			if parentMap, ok := parentVars.(map[string]any); ok {
-				if childVars, exists := parentMap[parts[1]]; exists {
-					data = mergeMaps(data, childVars)
-				}
-			}
+func (p *Processor) newBuild(loader *FileLoader, documents, partials []template.Template, names []string) (*build, error) {
+	metadata, err := newBuildMetadata(p.config, p.commit)
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorLoadingFiles,
+			Wrapped: errors.Wrap(err, "collecting build metadata"),
+		}
+	}
+
+	styles, err := loader.LoadStyles()
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorLoadingFiles,
+			Wrapped: errors.Wrap(err, "loading styles"),
+		}
+	}
+	if styles, err = loadHeadStyles(styles, p.config.MJML.Head); err != nil {
+		return nil, &Error{
+			Type:    ErrorLoadingFiles,
+			Wrapped: err,
 		}
 	}
 
+	renderer, err := p.newRenderer(documents, partials, styles, metadata)
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorLoadingFiles,
+			Wrapped: err,
+		}
+	}
+
+	return &build{
+		renderer: renderer,
+		resolver: NewVariableResolver(p.config.Template, names),
+		metadata: metadata,
+	}, nil
+}
+
+func (p *Processor) processDocument(doc template.Template, b *build) error {
+	data := b.resolver.Resolve(doc.Name)
+
+	if _, exists := data[MetadataKey]; exists {
+		slog.Warn("Variable is reserved and will be overwritten", "document", doc.Name, "variable", MetadataKey)
+	}
+	metadata := b.metadata.forDocument(doc, p.config.Paths.Documents, data)
+	data[MetadataKey] = metadata
+
 	// Render template
-	rendered, err := renderer.Render(doc.Name, data)
+	rendered, err := b.renderer.Render(doc.Name, data)
 	if err != nil {
+		errorType := ErrorRendering
+		if errors.Is(err, template.ErrLimitExceeded) {
+			errorType = ErrorLimitExceeded
+		}
 		return &Error{
-			Type:    ErrorRendering,
+			Type:    errorType,
 			Doc:     doc.Name,
 			Wrapped: errors.Wrap(err, "rendering template"),
 		}
 	}
 
-	// Compile to HTML
-	html, err := p.compiler.Compile(rendered)
+	// Documents with an event get one calendar file, shared by the output variants
+	event, err := b.renderer.Event(data)
+	if err != nil {
+		return &Error{
+			Type:    ErrorRendering,
+			Doc:     doc.Name,
+			Wrapped: errors.Wrap(err, "reading event"),
+		}
+	}
+	if event != nil {
+		if err := p.writeCalendar(doc, event.ICS(b.metadata.BuildTime)); err != nil {
+			return err
+		}
+	}
+
+	// Compile and save every output variant
+	options := p.compiler.Options(doc)
+	for _, variant := range p.config.OutputVariants() {
+		if err := p.writeVariant(doc, rendered, metadata.Locale, options, variant); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeCalendar writes the calendar file of a document to the output
+// directory, named like the document with the extension .ics.
+func (p *Processor) writeCalendar(doc template.Template, ics []byte) error {
+	icsPath := filepath.Join(p.config.Paths.Output, filepath.FromSlash(doc.Name)+".ics")
+	if err := os.MkdirAll(filepath.Dir(icsPath), 0755); err != nil {
+		return &Error{
+			Type:    ErrorSaving,
+			Doc:     doc.Name,
+			Wrapped: errors.Wrap(err, "creating output directory"),
+		}
+	}
+	if err := os.WriteFile(icsPath, ics, 0600); err != nil {
+		return &Error{
+			Type:    ErrorSaving,
+			Doc:     doc.Name,
+			Wrapped: errors.Wrap(err, "writing calendar file"),
+		}
+	}
+	return nil
+}
+
+// writeVariant compiles the rendered document with the options of an output
+// variant and writes it to the file of the variant. The MJML options do not
+// apply to plain HTML documents.
+func (p *Processor) writeVariant(doc template.Template, rendered string, locale string, options config.MJMLConfig, variant config.OutputVariant) error {
+	// Compile to HTML, plain HTML documents are already rendered
+	html := rendered
+	if !doc.HTML {
+		var err error
+		html, err = p.compiler.CompileWithOptions(rendered, options.Apply(variant.MJML))
+		if err != nil {
+			return &Error{
+				Type:    ErrorCompiling,
+				Doc:     doc.Name,
+				Wrapped: errors.Wrap(err, "compiling template"),
+			}
+		}
+	}
+
+	html = postProcess(html, variant.PostProcess)
+
+	file, err := outputFile(variant.File, doc.Name, locale, variant.Name)
 	if err != nil {
 		return &Error{
-			Type:    ErrorCompiling,
+			Type:    ErrorSaving,
 			Doc:     doc.Name,
-			Wrapped: errors.Wrap(err, "compiling template"),
+			Wrapped: err,
 		}
 	}
 
 	// Save to file
-	outputPath := filepath.Join(p.config.Paths.Output, doc.Name+".html")
+	outputPath := filepath.Join(p.config.Paths.Output, filepath.FromSlash(file))
+	if html, err = p.linkAssets(html, outputPath); err != nil {
+		return &Error{
+			Type:    ErrorSaving,
+			Doc:     doc.Name,
+			Wrapped: err,
+		}
+	}
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
 		return &Error{
 			Type:    ErrorSaving,
@@ -165,23 +416,15 @@ func (p *Processor) processDocument(doc template.Template, renderer *template.Re
 	return nil
 }
 
-func mergeMaps(target map[string]any, source any) map[string]any {
-	if source == nil {
-		return target
+// linkAssets replaces the prefix of generated images by the path of the assets
+// directory relative to the output file.
+func (p *Processor) linkAssets(html, outputPath string) (string, error) {
+	if !strings.Contains(html, relativeAssetsURL) {
+		return html, nil
 	}
-
-	switch v := source.(type) {
-	case map[string]any:
-		for key, val := range v {
-			target[key] = val
-		}
-	case map[interface{}]interface{}:
-		for key, val := range v {
-			if strKey, ok := key.(string); ok {
-				target[strKey] = val
-			}
-		}
+	rel, err := filepath.Rel(filepath.Dir(outputPath), p.config.Paths.Assets)
+	if err != nil {
+		return "", errors.Wrap(err, "linking assets")
 	}
-
-	return target
+	return strings.ReplaceAll(html, relativeAssetsURL+"/", filepath.ToSlash(rel)+"/"), nil
 }
@@ -3,6 +3,7 @@ package handler_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/bradleyjkemp/cupaloy/v2"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/esdete2/envelopr/config"
 	"github.com/esdete2/envelopr/handler"
+	"github.com/esdete2/envelopr/template"
 )
 
 func TestProcessor(t *testing.T) {
@@ -52,7 +54,7 @@ func TestProcessor(t *testing.T) {
 	cfg := &config.Config{
 		Paths: config.Paths{
 			Documents: docsDir,
-			Partials:  partialsDir,
+			Partials:  config.PartialDirs{{Path: partialsDir}},
 			Output:    outDir,
 		},
 		MJML: config.MJMLConfig{
@@ -109,7 +111,7 @@ func TestProcessor_Errors(t *testing.T) {
 		cfg := &config.Config{
 			Paths: config.Paths{
 				Documents: "/non/existent/path",
-				Partials:  "/another/non/existent",
+				Partials:  config.PartialDirs{{Path: "/another/non/existent"}},
 				Output:    "/tmp/out",
 			},
 		}
@@ -157,6 +159,39 @@ func TestProcessor_Errors(t *testing.T) {
 		r.Equal("invalid", procErr.Doc)
 	})
 
+	t.Run("limit exceeded", func(t *testing.T) {
+		tmpDir, err := os.MkdirTemp("", "envelopr-test")
+		r.NoError(err)
+		defer os.RemoveAll(tmpDir)
+
+		docsDir := filepath.Join(tmpDir, "documents")
+		r.NoError(os.MkdirAll(docsDir, 0755))
+		r.NoError(os.WriteFile(
+			filepath.Join(docsDir, "large.mjml"),
+			[]byte(`<mjml><mj-body><mj-text>{{ repeat 1000 "spam" }}</mj-text></mj-body></mjml>`),
+			0644,
+		))
+
+		cfg := &config.Config{
+			Paths: config.Paths{
+				Documents: docsDir,
+				Output:    filepath.Join(tmpDir, "dist"),
+			},
+			Template: config.TemplateConfig{
+				Limits: config.LimitsConfig{MaxOutputSize: 1024},
+			},
+		}
+
+		processor, err := handler.NewProcessor(cfg)
+		r.NoError(err)
+
+		err = processor.Process()
+		var procErr *handler.Error
+		r.ErrorAs(err, &procErr)
+		r.Equal(handler.ErrorLimitExceeded, procErr.Type)
+		r.Equal("large", procErr.Doc)
+	})
+
 	t.Run("non-writable output directory", func(t *testing.T) {
 		tmpDir, err := os.MkdirTemp("", "envelopr-test")
 		r.NoError(err)
@@ -251,3 +286,397 @@ func TestProcessor_Configuration(t *testing.T) {
 		r.Less(len(minContent), len(prettyContent), "minified content should be shorter")
 	})
 }
+
+func TestProcessor_Metadata(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	r.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	docsDir := filepath.Join(tmpDir, "documents")
+	outDir := filepath.Join(tmpDir, "dist")
+
+	r.NoError(os.MkdirAll(filepath.Join(docsDir, "shop"), 0755))
+	r.NoError(os.WriteFile(
+		filepath.Join(docsDir, "shop", "invoice.mjml"),
+		[]byte(`<mjml><mj-body><mj-section><mj-column><mj-text>{{ .Envelopr.Name }}|{{ .Envelopr.Path }}|{{ .Envelopr.BuildTime.Year }}|{{ .Envelopr.Locale }}|{{ .Envelopr.Env.STAGE }}|{{ len .Envelopr.Env }}|{{ .Envelopr.Commit }}</mj-text></mj-column></mj-section></mj-body></mjml>`),
+		0644,
+	))
+
+	t.Setenv("STAGE", "staging")
+	t.Setenv("SECRET", "hidden")
+
+	cfg := &config.Config{
+		Paths: config.Paths{
+			Documents: docsDir,
+			Output:    outDir,
+		},
+		Template: config.TemplateConfig{
+			Locale: "en-US",
+			Documents: map[string]any{
+				"shop": map[string]any{
+					"locale": "de-DE",
+				},
+			},
+		},
+		Build: config.BuildConfig{
+			Time:   "2023-05-01T10:00:00Z",
+			Commit: "0123abc",
+			Env:    []string{"STAGE"},
+		},
+	}
+
+	processor, err := handler.NewProcessor(cfg)
+	r.NoError(err)
+	r.NoError(processor.Process())
+
+	content, err := os.ReadFile(filepath.Join(outDir, "shop", "invoice.html"))
+	r.NoError(err)
+	r.Contains(string(content), "shop/invoice|shop/invoice.mjml|2023|de-DE|staging|1|0123abc")
+	r.NotContains(string(content), "hidden")
+}
+
+func TestProcessor_OutputVariants(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	r.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	docsDir := filepath.Join(tmpDir, "documents")
+	outDir := filepath.Join(tmpDir, "dist")
+
+	r.NoError(os.MkdirAll(filepath.Join(docsDir, "shop"), 0755))
+	for _, name := range []string{"welcome.mjml", "shop/invoice.mjml"} {
+		r.NoError(os.WriteFile(
+			filepath.Join(docsDir, name),
+			[]byte(`<mjml><mj-body><mj-section><mj-column><mj-text>Hello</mj-text></mj-column></mj-section></mj-body></mjml>`),
+			0644,
+		))
+	}
+
+	minify, beautify := true, true
+	cfg := &config.Config{
+		Paths: config.Paths{
+			Documents:  docsDir,
+			Output:     outDir,
+			OutputFile: "{dir}/{name}.{locale}.{variant}.gohtml",
+		},
+		MJML: config.MJMLConfig{
+			ValidationLevel: "soft",
+		},
+		Template: config.TemplateConfig{
+			Documents: map[string]any{
+				"shop": map[string]any{
+					"locale": "de",
+				},
+			},
+		},
+		Outputs: map[string]config.OutputConfig{
+			"min": {
+				MJML:        config.MJMLOverride{Minify: &minify},
+				PostProcess: []string{"trim"},
+			},
+			"pretty": {
+				MJML:        config.MJMLOverride{Beautify: &beautify},
+				PostProcess: []string{"crlf"},
+			},
+		},
+	}
+	r.Equal([]string{".gohtml"}, cfg.OutputExtensions())
+
+	processor, err := handler.NewProcessor(cfg)
+	r.NoError(err)
+	r.NoError(processor.Process())
+
+	// Empty placeholders are removed with their separator
+	minified, err := os.ReadFile(filepath.Join(outDir, "welcome.min.gohtml"))
+	r.NoError(err)
+	pretty, err := os.ReadFile(filepath.Join(outDir, "welcome.pretty.gohtml"))
+	r.NoError(err)
+	r.Less(len(minified), len(pretty))
+	r.Contains(string(pretty), "\r\n")
+	r.NotContains(string(minified), "\r\n")
+
+	r.FileExists(filepath.Join(outDir, "shop", "invoice.de.min.gohtml"))
+	r.FileExists(filepath.Join(outDir, "shop", "invoice.de.pretty.gohtml"))
+	r.NoFileExists(filepath.Join(outDir, "welcome.html"))
+}
+
+func TestProcessor_HTMLDocuments(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir, err := os.MkdirTemp("", "envelopr-test")
+	r.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	docsDir := filepath.Join(tmpDir, "documents")
+	partialsDir := filepath.Join(tmpDir, "partials")
+	outDir := filepath.Join(tmpDir, "dist")
+
+	files := map[string]string{
+		"documents/legacy.gohtml":  "  <html><body>Hello {{ .name }}</body></html>\n",
+		"documents/welcome.mjml":   `<mjml><mj-body><mj-raw>{{ template "tracking" . }}</mj-raw></mj-body></mjml>`,
+		"partials/tracking.html":   `<img src="https://example.com/{{ .name }}.gif">`,
+		"partials/unrelated.mjml":  `<mj-text>unused</mj-text>`,
+		"documents/notes/todo.txt": "ignored",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(tmpDir, path)
+		r.NoError(os.MkdirAll(filepath.Dir(fullPath), 0755))
+		r.NoError(os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	cfg := &config.Config{
+		Paths: config.Paths{
+			Documents: docsDir,
+			Partials:  config.PartialDirs{{Path: partialsDir}},
+			Output:    outDir,
+		},
+		MJML: config.MJMLConfig{
+			ValidationLevel: "soft",
+		},
+		Template: config.TemplateConfig{
+			Variables: map[string]any{"name": "Jane"},
+		},
+		Extensions: config.ExtensionsConfig{
+			Partials: []string{".mjml", ".html"},
+			HTML:     []string{".gohtml"},
+		},
+		Outputs: map[string]config.OutputConfig{
+			"html": {PostProcess: []string{"trim"}},
+		},
+	}
+
+	processor, err := handler.NewProcessor(cfg)
+	r.NoError(err)
+	r.NoError(processor.Process())
+
+	// Plain HTML documents are rendered and post-processed, but not compiled
+	legacy, err := os.ReadFile(filepath.Join(outDir, "legacy.html"))
+	r.NoError(err)
+	r.Equal("<html><body>Hello Jane</body></html>", string(legacy))
+
+	welcome, err := os.ReadFile(filepath.Join(outDir, "welcome.html"))
+	r.NoError(err)
+	r.Contains(string(welcome), `<img src="https://example.com/Jane.gif">`)
+	r.Contains(string(welcome), "<!doctype html>")
+}
+
+func TestProcessor_Events(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir := t.TempDir()
+	docsDir := filepath.Join(tmpDir, "documents")
+	outDir := filepath.Join(tmpDir, "dist")
+	r.NoError(os.MkdirAll(docsDir, 0755))
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "webinar.gohtml"), []byte(`<a href="{{ googleCalendarUrl .event }}">Add</a>`), 0644))
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "plain.gohtml"), []byte(`plain`), 0644))
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "sale.gohtml"), []byte(`{{ .event }}`), 0644))
+
+	cfg := &config.Config{
+		Paths: config.Paths{
+			Documents: docsDir,
+			Output:    outDir,
+		},
+		Build: config.BuildConfig{Time: "2024-03-05T14:30:00Z"},
+		Template: config.TemplateConfig{
+			Timezone: "Europe/Berlin",
+			Documents: map[string]any{
+				"sale": map[string]any{"event": "Black Friday"},
+				"webinar": map[string]any{
+					"event": map[string]any{
+						"title":    "Product Webinar",
+						"start":    "2024-05-01 15:00",
+						"duration": "1h",
+						"organizer": map[string]any{
+							"name":  "ACME Events",
+							"email": "events@example.com",
+						},
+					},
+				},
+			},
+		},
+		Extensions: config.ExtensionsConfig{
+			HTML: []string{".gohtml"},
+		},
+		Outputs: map[string]config.OutputConfig{
+			"html": {File: "{path}.html"},
+			"min":  {File: "{path}.min.html"},
+		},
+	}
+
+	// The event variable is an ordinary variable unless it is configured
+	processor, err := handler.NewProcessor(cfg)
+	r.NoError(err)
+	r.NoError(processor.Process())
+	r.NoFileExists(filepath.Join(outDir, "webinar.ics"))
+
+	cfg.Template.Event = "event"
+	cfg.Template.Documents["sale"] = map[string]any{}
+	r.NoError(processor.Process())
+
+	// One calendar file is written for all output variants
+	r.NoFileExists(filepath.Join(outDir, "webinar.min.ics"))
+	ics, err := os.ReadFile(filepath.Join(outDir, "webinar.ics"))
+	r.NoError(err)
+	r.Contains(string(ics), "DTSTAMP:20240305T143000Z\r\n")
+	r.Contains(string(ics), "DTSTART:20240501T130000Z\r\n")
+	r.Contains(string(ics), "DTEND:20240501T140000Z\r\n")
+	r.Contains(string(ics), "ORGANIZER;CN=\"ACME Events\":mailto:events@example.com\r\n")
+
+	html, err := os.ReadFile(filepath.Join(outDir, "webinar.html"))
+	r.NoError(err)
+	r.Contains(string(html), "dates=20240501T130000Z%2F20240501T140000Z")
+
+	_, err = os.Stat(filepath.Join(outDir, "plain.ics"))
+	r.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestProcessor_Head(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir := t.TempDir()
+	docsDir := filepath.Join(tmpDir, "documents")
+	partialsDir := filepath.Join(tmpDir, "partials")
+	outDir := filepath.Join(tmpDir, "dist")
+	r.NoError(os.MkdirAll(docsDir, 0755))
+	r.NoError(os.MkdirAll(partialsDir, 0755))
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "welcome.mjml"), []byte(`<mjml><mj-body><mj-section><mj-column><mj-text css-class="note">Hello</mj-text></mj-column></mj-section></mj-body></mjml>`), 0644))
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "raw.mjml"), []byte("---\nhead: false\n---\n<mjml><mj-body><mj-section><mj-column><mj-text>Raw</mj-text></mj-column></mj-section></mj-body></mjml>"), 0644))
+	r.NoError(os.WriteFile(filepath.Join(partialsDir, "breakpoint.mjml"), []byte(`<mj-breakpoint width="{{ .breakpoint }}" />`), 0644))
+	r.NoError(os.WriteFile(filepath.Join(tmpDir, "dark.css"), []byte("@media (prefers-color-scheme: dark) { .note { color: #ffffff; } }"), 0644))
+
+	cfg := &config.Config{
+		Paths: config.Paths{
+			Documents: docsDir,
+			Partials:  config.PartialDirs{{Path: partialsDir}},
+			Output:    outDir,
+		},
+		MJML: config.MJMLConfig{
+			ValidationLevel: "soft",
+			Head: []config.HeadFragment{
+				{MJML: `<mj-attributes><mj-text color="#123456" /></mj-attributes>`},
+				{Partial: "breakpoint"},
+				{CSS: filepath.Join(tmpDir, "dark.css")},
+			},
+		},
+		Template: config.TemplateConfig{
+			Variables: map[string]any{"breakpoint": "320px"},
+		},
+	}
+
+	processor, err := handler.NewProcessor(cfg)
+	r.NoError(err)
+	r.NoError(processor.Process())
+
+	html, err := os.ReadFile(filepath.Join(outDir, "welcome.html"))
+	r.NoError(err)
+	r.Contains(string(html), "color:#123456")
+	r.Contains(string(html), "@media only screen and (min-width:320px)")
+	r.Contains(string(html), ".note { color: #ffffff; }")
+
+	html, err = os.ReadFile(filepath.Join(outDir, "raw.html"))
+	r.NoError(err)
+	r.NotContains(string(html), "#123456")
+	r.NotContains(string(html), "prefers-color-scheme")
+
+	// Documents opting out of the head do not include its stylesheets
+	r.NoError(os.RemoveAll(outDir))
+	r.NoError(processor.ProcessStyle(template.HeadStyle(filepath.Join(tmpDir, "dark.css"))))
+	r.FileExists(filepath.Join(outDir, "welcome.html"))
+	r.NoFileExists(filepath.Join(outDir, "raw.html"))
+
+	cfg.MJML.Head = []config.HeadFragment{{CSS: filepath.Join(tmpDir, "missing.css")}}
+	r.Error(processor.Process())
+}
+
+func TestProcessor_Styles(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir := t.TempDir()
+	docsDir := filepath.Join(tmpDir, "documents")
+	stylesDir := filepath.Join(tmpDir, "styles")
+	outDir := filepath.Join(tmpDir, "dist")
+	r.NoError(os.MkdirAll(docsDir, 0755))
+	r.NoError(os.MkdirAll(stylesDir, 0755))
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "welcome.mjml"), []byte(`<mjml><mj-head>{{ inlineStylesheet "utilities" }}</mj-head>`+
+		`<mj-body><mj-section><mj-column><mj-text css-class="muted">Hello</mj-text></mj-column></mj-section></mj-body></mjml>`), 0644))
+	r.NoError(os.WriteFile(filepath.Join(stylesDir, "utilities.css"), []byte(".muted { color: #6b7280; }"), 0644))
+	r.NoError(os.WriteFile(filepath.Join(stylesDir, "dark.css"), []byte("@media (prefers-color-scheme: dark) { .muted { color: #d1d5db; } }"), 0644))
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "plain.mjml"), []byte(`<mjml><mj-body><mj-section><mj-column><mj-text>Plain</mj-text></mj-column></mj-section></mj-body></mjml>`), 0644))
+
+	cfg := &config.Config{
+		Paths: config.Paths{
+			Documents: docsDir,
+			Output:    outDir,
+			Styles:    stylesDir,
+		},
+		MJML: config.MJMLConfig{
+			ValidationLevel: "soft",
+			Head:            []config.HeadFragment{{MJML: `{{ stylesheet "dark" }}`}},
+		},
+	}
+
+	processor, err := handler.NewProcessor(cfg)
+	r.NoError(err)
+	r.NoError(processor.Process())
+
+	html, err := os.ReadFile(filepath.Join(outDir, "welcome.html"))
+	r.NoError(err)
+	r.Contains(string(html), `class="muted" style="color: #6b7280;`)
+	r.Contains(string(html), `.muted { color: #d1d5db; }`)
+
+	// Only the documents including a stylesheet are rebuilt when it changes
+	r.NoError(os.RemoveAll(outDir))
+	r.NoError(processor.ProcessStyle("utilities"))
+	r.FileExists(filepath.Join(outDir, "welcome.html"))
+	r.NoFileExists(filepath.Join(outDir, "plain.html"))
+	r.NoError(processor.ProcessStyle("dark"))
+	r.FileExists(filepath.Join(outDir, "plain.html"))
+}
+
+func TestProcessor_Assets(t *testing.T) {
+	r := require.New(t)
+
+	tmpDir := t.TempDir()
+	docsDir := filepath.Join(tmpDir, "documents")
+	outDir := filepath.Join(tmpDir, "dist")
+	r.NoError(os.MkdirAll(filepath.Join(docsDir, "shop"), 0755))
+	content := []byte(`<img src="{{ qrcode (dict "file" true) "https://example.com/orders/42" }}">`)
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "welcome.gohtml"), content, 0644))
+	r.NoError(os.WriteFile(filepath.Join(docsDir, "shop", "invoice.gohtml"), content, 0644))
+
+	cfg := &config.Config{
+		Paths: config.Paths{
+			Documents: docsDir,
+			Output:    outDir,
+			Assets:    filepath.Join(outDir, "assets"),
+		},
+		Extensions: config.ExtensionsConfig{
+			HTML: []string{".gohtml"},
+		},
+	}
+
+	processor, err := handler.NewProcessor(cfg)
+	r.NoError(err)
+	r.NoError(processor.Process())
+
+	for file, prefix := range map[string]string{"welcome.html": "assets/", "shop/invoice.html": "../assets/"} {
+		html, err := os.ReadFile(filepath.Join(outDir, file))
+		r.NoError(err)
+		src := strings.TrimSuffix(strings.TrimPrefix(string(html), `<img src="`), `">`)
+		r.True(strings.HasPrefix(src, prefix), src)
+
+		// The link resolves from the directory of the output file
+		_, err = os.Stat(filepath.Join(outDir, filepath.Dir(file), filepath.FromSlash(src)))
+		r.NoError(err)
+	}
+
+	cfg.Paths.AssetsURL = "https://cdn.example.com/email"
+	r.NoError(processor.Process())
+	html, err := os.ReadFile(filepath.Join(outDir, "shop", "invoice.html"))
+	r.NoError(err)
+	r.Contains(string(html), `src="https://cdn.example.com/email/`)
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+type variableRule struct {
+	path string
+	vars map[string]any
+}
+
+// VariableResolver resolves the effective template variables of a document.
+//
+// Variables are merged in the following order, later layers win:
+//  1. global variables (template.variables)
+//  2. directory defaults, from the top-level directory down to the document's directory
+//  3. glob rules like "marketing/*" or "**/receipt", less specific patterns first
+//  4. exact document rules
+//
+// Rules in template.documents can be written as slash separated keys
+// ("marketing/2024/spring") or as nested maps. A nested key is treated as a rule
+// if it names a known document or directory or contains glob characters,
+// otherwise it is a variable of the enclosing rule.
+type VariableResolver struct {
+	globals map[string]any
+	rules   []variableRule
+}
+
+func NewVariableResolver(cfg config.TemplateConfig, documents []string) *VariableResolver {
+	known := make(map[string]bool)
+	for _, name := range documents {
+		parts := strings.Split(name, "/")
+		for i := range parts {
+			known[strings.Join(parts[:i+1], "/")] = true
+		}
+	}
+
+	resolver := &VariableResolver{
+		globals: cfg.Variables,
+	}
+
+	for _, key := range sortedKeys(cfg.Documents) {
+		vars, ok := config.ToStringMap(cfg.Documents[key])
+		if !ok {
+			continue
+		}
+		resolver.addRule(strings.Trim(key, "/"), vars, known)
+	}
+
+	return resolver
+}
+
+// addRule registers the rule for the given path and recursively all nested rules.
+func (r *VariableResolver) addRule(path string, values map[string]any, known map[string]bool) {
+	vars := make(map[string]any)
+	var nested []string
+
+	for _, key := range sortedKeys(values) {
+		childPath := path + "/" + strings.Trim(key, "/")
+		_, isMap := config.ToStringMap(values[key])
+		if isMap && (known[childPath] || config.IsPattern(key) || strings.Contains(key, "/")) {
+			nested = append(nested, key)
+			continue
+		}
+		vars[key] = values[key]
+	}
+
+	r.rules = append(r.rules, variableRule{path: path, vars: vars})
+
+	for _, key := range nested {
+		childVars, _ := config.ToStringMap(values[key])
+		r.addRule(path+"/"+strings.Trim(key, "/"), childVars, known)
+	}
+}
+
+// Resolve returns the merged variables for the document with the given name.
+func (r *VariableResolver) Resolve(name string) map[string]any {
+	paths := make([]string, len(r.rules))
+	for i, rule := range r.rules {
+		paths[i] = rule.path
+	}
+
+	data := config.DeepMerge(nil, r.globals)
+	for _, i := range config.MatchRules(paths, name) {
+		data = config.DeepMerge(data, r.rules[i].vars)
+	}
+
+	return data
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,142 @@
+package handler_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/config"
+	"github.com/esdete2/envelopr/handler"
+)
+
+func TestVariableResolver(t *testing.T) {
+	documents := []string{
+		"welcome",
+		"shop/invoice",
+		"shop/receipt",
+		"marketing/2024/spring",
+		"marketing/2024/summer",
+		"marketing/promo",
+	}
+
+	cfg := config.TemplateConfig{
+		Variables: map[string]any{
+			"company": "ACME",
+			"theme": map[string]any{
+				"color": "blue",
+				"font":  "Arial",
+			},
+		},
+		Documents: map[string]any{
+			"welcome": map[string]any{
+				"name": "World",
+			},
+			"shop": map[string]any{
+				"currency": "EUR",
+				"invoice": map[string]any{
+					"title": "Invoice",
+				},
+				"receipt": map[string]any{
+					"title": "Receipt",
+				},
+			},
+			"marketing": map[string]any{
+				"campaign": "default",
+				"theme": map[string]any{
+					"color": "red",
+				},
+				"2024": map[string]any{
+					"year": 2024,
+					"spring": map[string]any{
+						"campaign": "spring",
+					},
+				},
+			},
+			"marketing/*": map[string]any{
+				"campaign": "glob",
+				"flat":     true,
+			},
+			"**/receipt": map[string]any{
+				"footer": "Thanks for your purchase",
+			},
+		},
+	}
+
+	resolver := handler.NewVariableResolver(cfg, documents)
+
+	t.Run("exact document", func(t *testing.T) {
+		r := require.New(t)
+
+		vars := resolver.Resolve("welcome")
+		r.Equal("World", vars["name"])
+		r.Equal("ACME", vars["company"])
+	})
+
+	t.Run("nested documents do not leak into siblings", func(t *testing.T) {
+		r := require.New(t)
+
+		vars := resolver.Resolve("shop/invoice")
+		r.Equal("Invoice", vars["title"])
+		r.Equal("EUR", vars["currency"])
+		r.NotContains(vars, "invoice")
+		r.NotContains(vars, "receipt")
+		r.NotContains(vars, "footer")
+	})
+
+	t.Run("directory defaults at arbitrary depth", func(t *testing.T) {
+		r := require.New(t)
+
+		vars := resolver.Resolve("marketing/2024/spring")
+		r.Equal("spring", vars["campaign"])
+		r.Equal(2024, vars["year"])
+		r.NotContains(vars, "flat")
+
+		vars = resolver.Resolve("marketing/2024/summer")
+		r.Equal("default", vars["campaign"])
+		r.Equal(2024, vars["year"])
+	})
+
+	t.Run("glob rules", func(t *testing.T) {
+		r := require.New(t)
+
+		vars := resolver.Resolve("marketing/promo")
+		r.Equal("glob", vars["campaign"])
+		r.Equal(true, vars["flat"])
+
+		vars = resolver.Resolve("shop/receipt")
+		r.Equal("Thanks for your purchase", vars["footer"])
+		r.Equal("Receipt", vars["title"])
+	})
+
+	t.Run("deep merge of nested maps", func(t *testing.T) {
+		r := require.New(t)
+
+		vars := resolver.Resolve("marketing/promo")
+		r.Equal(map[string]any{"color": "red", "font": "Arial"}, vars["theme"])
+
+		// Config values are not modified by merging
+		r.Equal("blue", cfg.Variables["theme"].(map[string]any)["color"])
+	})
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"marketing/*", "marketing/promo", true},
+		{"marketing/*", "marketing/2024/spring", false},
+		{"marketing/**", "marketing/2024/spring", true},
+		{"**/receipt", "receipt", true},
+		{"**/receipt", "shop/eu/receipt", true},
+		{"**/receipt", "shop/receipts", false},
+		{"shop/*-mail", "shop/order-mail", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.pattern+" "+tc.name, func(t *testing.T) {
+			require.Equal(t, tc.match, config.MatchPattern(tc.pattern, tc.name))
+		})
+	}
+}
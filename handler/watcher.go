@@ -13,6 +13,7 @@ import (
 	"github.com/networkteam/slogutils"
 
 	"github.com/esdete2/envelopr/config"
+	"github.com/esdete2/envelopr/template"
 )
 
 type Watcher struct {
@@ -54,37 +55,51 @@ func NewWatcher(proc *Processor, cfg *config.Config, notifier ReloadNotifier) (*
 }
 
 func (w *Watcher) addDirsToWatch() error {
+	addDirs := func(root string) error {
+		return walkFiles(root, func(path string, info os.FileInfo) error {
+			if info.IsDir() {
+				return w.fsWatcher.Add(path)
+			}
+			return nil
+		})
+	}
+
 	// Watch documents directory
-	if err := filepath.Walk(w.config.Paths.Documents, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return w.fsWatcher.Add(path)
-		}
-		return nil
-	}); err != nil {
+	if err := addDirs(w.config.Paths.Documents); err != nil {
 		return errors.Wrap(err, "watching documents directory")
 	}
 
-	// Watch partials directory
-	if err := filepath.Walk(w.config.Paths.Partials, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	// Watch all partial directories
+	for _, dir := range w.config.Paths.Partials {
+		if err := addDirs(dir.Path); err != nil {
+			return errors.Wrapf(err, "watching partials directory %s", dir.Path)
 		}
-		if info.IsDir() {
-			return w.fsWatcher.Add(path)
+	}
+
+	// Watch the styles directory if it exists and the stylesheets of the head
+	if _, err := os.Stat(w.config.Paths.Styles); err == nil {
+		if err := addDirs(w.config.Paths.Styles); err != nil {
+			return errors.Wrap(err, "watching styles directory")
+		}
+	}
+	for _, fragment := range w.config.MJML.Head {
+		if fragment.CSS == "" {
+			continue
+		}
+		if err := w.fsWatcher.Add(filepath.Dir(fragment.CSS)); err != nil {
+			return errors.Wrapf(err, "watching stylesheet %s", fragment.CSS)
 		}
-		return nil
-	}); err != nil {
-		return errors.Wrap(err, "watching partials directory")
 	}
 
 	return nil
 }
 
 func (w *Watcher) Watch() error {
-	slog.With("documents", w.config.Paths.Documents).With("partials", w.config.Paths.Partials).Info("Watching for changes...")
+	partials := make([]string, 0, len(w.config.Paths.Partials))
+	for _, dir := range w.config.Paths.Partials {
+		partials = append(partials, dir.Path)
+	}
+	slog.With("documents", w.config.Paths.Documents).With("partials", partials).Info("Watching for changes...")
 
 	go func() {
 		defer w.fsWatcher.Close()
@@ -95,9 +110,8 @@ func (w *Watcher) Watch() error {
 					return
 				}
 
-				// Skip temporary files and non-MJML files
-				if strings.HasPrefix(filepath.Base(event.Name), ".") ||
-					!strings.HasSuffix(event.Name, ".mjml") {
+				// Skip temporary files and files that are no templates or stylesheets
+				if strings.HasPrefix(filepath.Base(event.Name), ".") || !(w.isTemplate(event.Name) || w.isStylesheet(event.Name)) {
 					continue
 				}
 
@@ -141,10 +155,8 @@ func (w *Watcher) handleFileEvent(event fsnotify.Event) error {
 
 	// Set new timer for debouncing
 	w.timer = time.AfterFunc(w.debounceTime, func() {
-		isPartial := strings.HasPrefix(event.Name, w.config.Paths.Partials)
-
 		// If it's a partial or create/remove/rename operation, rebuild all templates
-		if isPartial || event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+		if w.isPartial(event.Name) || event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
 			slog.Info("Rebuilding all templates...")
 			if err := w.processor.Process(); err != nil {
 				slog.Error("Error rebuilding templates", slogutils.Err(err))
@@ -154,6 +166,17 @@ func (w *Watcher) handleFileEvent(event fsnotify.Event) error {
 			return
 		}
 
+		// For stylesheet write changes, rebuild the templates including it
+		if style, ok := w.stylesheet(event.Name); ok && event.Op&fsnotify.Write != 0 {
+			slog.With("stylesheet", style).Info("Rebuilding templates including stylesheet...")
+			if err := w.processor.ProcessStyle(style); err != nil {
+				slog.Error("Error rebuilding templates", slogutils.Err(err))
+			} else {
+				w.notifier.NotifyReload()
+			}
+			return
+		}
+
 		// For document write changes, rebuild only the changed template
 		if event.Op&fsnotify.Write != 0 {
 			relPath, err := filepath.Rel(w.config.Paths.Documents, event.Name)
@@ -162,7 +185,7 @@ func (w *Watcher) handleFileEvent(event fsnotify.Event) error {
 				return
 			}
 
-			templateName := strings.TrimSuffix(filepath.ToSlash(relPath), ".mjml")
+			templateName, _, _ := config.TrimExtension(filepath.ToSlash(relPath), w.config.Extensions.DocumentExtensions())
 			slog.With("template", templateName).Info("Rebuilding template...")
 
 			if err := w.processor.ProcessSingle(templateName); err != nil {
@@ -175,3 +198,56 @@ func (w *Watcher) handleFileEvent(event fsnotify.Event) error {
 
 	return nil
 }
+
+// isPartial reports whether path is in a partial directory or is a local
+// partial in the documents directory.
+func (w *Watcher) isPartial(path string) bool {
+	for _, dir := range w.config.Paths.Partials {
+		if strings.HasPrefix(path, dir.Path+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	relPath, err := filepath.Rel(w.config.Paths.Documents, path)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+	_, _, ok := localPartial(filepath.ToSlash(relPath))
+	return ok
+}
+
+// isStylesheet reports whether path is a CSS file in the styles directory or a
+// stylesheet of the head fragments.
+func (w *Watcher) isStylesheet(path string) bool {
+	_, ok := w.stylesheet(path)
+	return ok
+}
+
+// stylesheet returns the name of the stylesheet at path, as included by the
+// templates.
+func (w *Watcher) stylesheet(path string) (string, bool) {
+	for _, fragment := range w.config.MJML.Head {
+		if fragment.CSS != "" && filepath.Clean(fragment.CSS) == filepath.Clean(path) {
+			return template.HeadStyle(fragment.CSS), true
+		}
+	}
+	if !strings.HasPrefix(path, w.config.Paths.Styles+string(filepath.Separator)) || filepath.Ext(path) != StyleExtension {
+		return "", false
+	}
+	relPath, err := filepath.Rel(w.config.Paths.Styles, path)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(filepath.ToSlash(relPath), StyleExtension), true
+}
+
+// isTemplate reports whether path has the extension of a document or partial,
+// depending on the directory it is in.
+func (w *Watcher) isTemplate(path string) bool {
+	extensions := w.config.Extensions.DocumentExtensions()
+	if w.isPartial(path) {
+		extensions = w.config.Extensions.PartialExtensions()
+	}
+	_, _, ok := config.TrimExtension(filepath.ToSlash(path), extensions)
+	return ok
+}
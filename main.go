@@ -34,6 +34,8 @@ func main() {
 			cmd.InitCmd(),
 			cmd.BuildCmd(),
 			cmd.WatchCmd(),
+			cmd.VarsCmd(),
+			cmd.ConfigCmd(),
 			cmd.VersionCmd(),
 		},
 	}
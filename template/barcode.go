@@ -0,0 +1,243 @@
+package template
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+	"github.com/friendsofgo/errors"
+)
+
+// Assets is the directory images generated by templates are written to.
+type Assets struct {
+	// Dir is the directory the files are written to
+	Dir string
+	// URL is the prefix of the file names in the rendered documents
+	URL string
+}
+
+// WithAssets sets the directory of generated images. Without it images can
+// only be embedded as data URI.
+func WithAssets(assets Assets) RendererOption {
+	return func(r *Renderer) {
+		r.assets = assets
+	}
+}
+
+// barcodeOptions are the options of the barcode functions, given as dict
+// before the content.
+type barcodeOptions struct {
+	// width and height of the image in pixels, set together by size
+	width  int
+	height int
+	level  qr.ErrorCorrectionLevel
+	colors barcode.ColorScheme
+	// file writes the image to the assets directory instead of embedding it
+	file bool
+}
+
+// maxBarcodeSize is the maximum width and height of a barcode image in pixels,
+// larger images take a lot of memory to render.
+const maxBarcodeSize = 2000
+
+// qrLevels are the error correction levels of QR codes, recovering 7%, 15%, 25%
+// and 30% of the code.
+//
+//nolint:gochecknoglobals
+var qrLevels = map[string]qr.ErrorCorrectionLevel{"L": qr.L, "M": qr.M, "Q": qr.Q, "H": qr.H}
+
+// barcodeFuncs returns the functions generating QR codes and Code 128 barcodes
+// as PNG images. They return a data URI or, with the file option, the URL of
+// the image in the assets directory. Restricted templates cannot write files:
+//
+//	<mj-image src="{{ qrcode .orderUrl }}" />
+//	<mj-image src="{{ qrcode (dict "size" 300 "level" "H" "color" "#1e3a8a") .orderUrl }}" />
+//	<mj-image src="{{ barcode (dict "height" 60 "file" true) .orderNumber }}" />
+func barcodeFuncs(assets Assets, restricted bool) template.FuncMap {
+	generate := func(args []any, defaults barcodeOptions, encode func(string, barcodeOptions) (barcode.Barcode, error)) (HTML, error) {
+		options, content, err := barcodeArgs(args, defaults)
+		if err != nil {
+			return "", err
+		}
+		code, err := encode(content, options)
+		if err != nil {
+			return "", errors.Wrapf(ErrInvalidValue, "encoding %q: %v", content, err)
+		}
+
+		scaled, err := barcode.Scale(code, options.width, options.height)
+		if err != nil {
+			return "", errors.Wrapf(ErrInvalidValue, "encoding %q: %v", content, err)
+		}
+		data, err := encodePNG(scaled, options.colors)
+		if err != nil {
+			return "", err
+		}
+
+		if options.file {
+			if restricted {
+				return "", errors.Wrap(ErrRestricted, "barcode option file")
+			}
+			return assets.write(data)
+		}
+		return HTML("data:image/png;base64," + base64.StdEncoding.EncodeToString(data)), nil
+	}
+
+	colors := barcode.ColorScheme{
+		Model:      color.RGBAModel,
+		Background: color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		Foreground: color.RGBA{A: 255},
+	}
+
+	return template.FuncMap{
+		"qrcode": func(args ...any) (HTML, error) {
+			return generate(args, barcodeOptions{width: 200, height: 200, level: qr.M, colors: colors}, func(content string, o barcodeOptions) (barcode.Barcode, error) {
+				return qr.EncodeWithColor(content, o.level, qr.Auto, o.colors)
+			})
+		},
+		"barcode": func(args ...any) (HTML, error) {
+			return generate(args, barcodeOptions{width: 300, height: 80, colors: colors}, func(content string, o barcodeOptions) (barcode.Barcode, error) {
+				return code128.EncodeWithColor(content, o.colors)
+			})
+		},
+	}
+}
+
+// barcodeArgs splits the arguments of a barcode function into the optional
+// options dict and the content.
+func barcodeArgs(args []any, options barcodeOptions) (barcodeOptions, string, error) {
+	switch len(args) {
+	case 1:
+	case 2:
+		dict, ok := args[0].(map[string]any)
+		if !ok {
+			return options, "", errors.Wrapf(ErrInvalidValue, "expected options as dict, got %v", args[0])
+		}
+		for key, value := range dict {
+			if err := options.set(key, value); err != nil {
+				return options, "", err
+			}
+		}
+	default:
+		return options, "", errors.Wrapf(ErrInvalidValue, "expected content and optional options, got %d arguments", len(args))
+	}
+
+	content := fmt.Sprint(args[len(args)-1])
+	if args[len(args)-1] == nil || content == "" {
+		return options, "", errors.Wrap(ErrInvalidValue, "empty barcode content")
+	}
+	return options, content, nil
+}
+
+func (o *barcodeOptions) set(key string, value any) error {
+	switch key {
+	case "size", "width", "height":
+		v := reflect.ValueOf(value)
+		if !v.CanInt() || v.Int() <= 0 {
+			return errors.Wrapf(ErrInvalidValue, "%s: expected a positive number of pixels, got %v", key, value)
+		}
+		if v.Int() > maxBarcodeSize {
+			return errors.Wrapf(ErrInvalidValue, "%s: expected at most %d pixels, got %v", key, maxBarcodeSize, value)
+		}
+		if key != "height" {
+			o.width = int(v.Int())
+		}
+		if key != "width" {
+			o.height = int(v.Int())
+		}
+	case "level":
+		level, ok := qrLevels[strings.ToUpper(fmt.Sprint(value))]
+		if !ok {
+			return errors.Wrapf(ErrInvalidValue, "level: expected one of L, M, Q, H, got %v", value)
+		}
+		o.level = level
+	case "color", "background":
+		c, err := parseHexColor(fmt.Sprint(value))
+		if err != nil {
+			return errors.Wrapf(err, "%s", key)
+		}
+		if key == "color" {
+			o.colors.Foreground = c
+		} else {
+			o.colors.Background = c
+		}
+	case "file":
+		file, ok := value.(bool)
+		if !ok {
+			return errors.Wrapf(ErrInvalidValue, "file: expected true or false, got %v", value)
+		}
+		o.file = file
+	default:
+		return errors.Wrapf(ErrInvalidValue, "unknown barcode option %q", key)
+	}
+	return nil
+}
+
+// parseHexColor parses colors like #1e3a8a or #fff.
+func parseHexColor(s string) (color.RGBA, error) {
+	digits := strings.TrimPrefix(s, "#")
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) != 6 {
+		return color.RGBA{}, errors.Wrapf(ErrInvalidValue, "expected a color like #1e3a8a, got %q", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// encodePNG encodes the barcode as PNG with a two-color palette, which keeps
+// the images small.
+func encodePNG(code barcode.Barcode, colors barcode.ColorScheme) ([]byte, error) {
+	bounds := code.Bounds()
+	img := image.NewPaletted(bounds, color.Palette{colors.Background, colors.Foreground})
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.Set(x, y, code.At(x, y))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, errors.Wrap(err, "encoding image")
+	}
+	return buf.Bytes(), nil
+}
+
+// write stores an image in the assets directory, named by the hash of its
+// content so that the names are stable between builds, and returns its URL.
+func (a Assets) write(data []byte) (HTML, error) {
+	if a.Dir == "" {
+		return "", errors.Wrap(ErrInvalidValue, "no assets directory to write images to")
+	}
+
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:8]) + ".png"
+	file := filepath.Join(a.Dir, name)
+	if _, err := os.Stat(file); err != nil {
+		if err := os.MkdirAll(a.Dir, 0755); err != nil {
+			return "", errors.Wrap(err, "creating assets directory")
+		}
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			return "", errors.Wrap(err, "writing image")
+		}
+	}
+
+	if a.URL == "" {
+		return HTML(name), nil
+	}
+	return HTML(strings.TrimSuffix(a.URL, "/") + "/" + name), nil
+}
@@ -0,0 +1,112 @@
+package template_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/template"
+)
+
+func TestBarcodeFuncs(t *testing.T) {
+	render := func(t *testing.T, content string, opts ...template.RendererOption) (string, error) {
+		t.Helper()
+		docs := []template.Template{{Name: "doc", Content: content}}
+		return template.NewRenderer(docs, nil, opts...).Render("doc", map[string]any{
+			"url":   "https://example.com/orders/42",
+			"order": "ORD-0042",
+		})
+	}
+
+	decode := func(t *testing.T, uri string) (int, int) {
+		t.Helper()
+		data, found := strings.CutPrefix(uri, "data:image/png;base64,")
+		require.True(t, found, uri)
+		raw, err := base64.StdEncoding.DecodeString(data)
+		require.NoError(t, err)
+		img, err := png.Decode(bytes.NewReader(raw))
+		require.NoError(t, err)
+		return img.Bounds().Dx(), img.Bounds().Dy()
+	}
+
+	t.Run("data uri", func(t *testing.T) {
+		r := require.New(t)
+
+		result, err := render(t, `{{ qrcode .url }}`)
+		r.NoError(err)
+		width, height := decode(t, result)
+		r.Equal(200, width)
+		r.Equal(200, height)
+
+		result, err = render(t, `{{ barcode (dict "width" 400 "height" 60 "color" "#1e3a8a") .order }}`)
+		r.NoError(err)
+		width, height = decode(t, result)
+		r.Equal(400, width)
+		r.Equal(60, height)
+	})
+
+	t.Run("not escaped in attributes", func(t *testing.T) {
+		r := require.New(t)
+
+		result, err := render(t, `<mj-image src="{{ qrcode (dict "size" 100 "level" "H") .url }}" />`)
+		r.NoError(err)
+		r.Contains(result, `src="data:image/png;base64,`)
+	})
+
+	t.Run("asset files", func(t *testing.T) {
+		r := require.New(t)
+
+		dir := filepath.Join(t.TempDir(), "assets")
+		assets := template.WithAssets(template.Assets{Dir: dir, URL: "https://cdn.example.com/email/"})
+
+		first, err := render(t, `{{ qrcode (dict "file" true) .url }}`, assets)
+		r.NoError(err)
+		r.Regexp(`^https://cdn\.example\.com/email/[0-9a-f]{16}\.png$`, first)
+
+		second, err := render(t, `{{ qrcode (dict "file" true) .url }}`, assets)
+		r.NoError(err)
+		r.Equal(first, second) // names are stable
+
+		_, err = os.Stat(filepath.Join(dir, filepath.Base(first)))
+		r.NoError(err)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := render(t, `{{ qrcode (dict "level" "X") .url }}`)
+		r.ErrorIs(err, template.ErrInvalidValue)
+
+		_, err = render(t, `{{ barcode (dict "colour" "#000") .order }}`)
+		r.ErrorContains(err, `unknown barcode option "colour"`)
+
+		_, err = render(t, `{{ barcode (dict "width" 20) .order }}`)
+		r.ErrorIs(err, template.ErrInvalidValue)
+
+		_, err = render(t, `{{ qrcode (dict "size" 100000) .url }}`)
+		r.ErrorContains(err, "at most 2000 pixels")
+
+		_, err = render(t, `{{ qrcode (dict "file" true) .url }}`)
+		r.ErrorContains(err, "no assets directory")
+	})
+
+	t.Run("restricted", func(t *testing.T) {
+		r := require.New(t)
+
+		dir := filepath.Join(t.TempDir(), "assets")
+		_, err := render(t, `{{ qrcode (dict "file" true) .url }}`, template.WithAssets(template.Assets{Dir: dir}), template.WithRestricted())
+		r.ErrorIs(err, template.ErrRestricted)
+		_, err = os.Stat(dir)
+		r.ErrorIs(err, os.ErrNotExist)
+
+		result, err := render(t, `{{ qrcode .url }}`, template.WithRestricted())
+		r.NoError(err)
+		r.True(strings.HasPrefix(result, "data:image/png;base64,"))
+	})
+}
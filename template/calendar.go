@@ -0,0 +1,289 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/friendsofgo/errors"
+)
+
+// Event is a calendar event, read from the variable set with WithEvent:
+//
+//	event:
+//	  title: Product Webinar
+//	  start: 2024-05-01 15:00
+//	  duration: 1h             # or end: 2024-05-01 16:00
+//	  timezone: Europe/Berlin  # of start and end without zone
+//	  location: https://meet.example.com/webinar
+//	  organizer:
+//	    name: ACME Events
+//	    email: events@example.com
+type Event struct {
+	UID         string
+	Title       string
+	Description string
+	Location    string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	Organizer   Organizer
+}
+
+type Organizer struct {
+	Name  string
+	Email string
+}
+
+// ParseEvent reads an event from a map of the template data. Times without
+// zone are in the timezone of the event or location.
+func ParseEvent(value any, location *time.Location) (Event, error) {
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return Event{}, errors.Wrapf(ErrInvalidValue, "event: expected a map, got %v", value)
+	}
+
+	str := func(key string) string {
+		if v, ok := fields[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+
+	if name := str("timezone"); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return Event{}, errors.Wrapf(ErrInvalidValue, "event.timezone %q", name)
+		}
+		location = loc
+	}
+
+	event := Event{
+		UID:         str("uid"),
+		Title:       str("title"),
+		Description: str("description"),
+		Location:    str("location"),
+		URL:         str("url"),
+	}
+	if event.Title == "" {
+		return Event{}, errors.Wrap(ErrInvalidValue, "event.title is missing")
+	}
+
+	start, ok := fields["start"]
+	if !ok {
+		return Event{}, errors.Wrap(ErrInvalidValue, "event.start is missing")
+	}
+	var err error
+	if event.Start, err = toTime(start, location); err != nil {
+		return Event{}, errors.Wrap(err, "event.start")
+	}
+
+	switch {
+	case fields["end"] != nil:
+		if event.End, err = toTime(fields["end"], location); err != nil {
+			return Event{}, errors.Wrap(err, "event.end")
+		}
+	case fields["duration"] != nil:
+		duration, err := time.ParseDuration(str("duration"))
+		if err != nil {
+			return Event{}, errors.Wrapf(ErrInvalidValue, "event.duration %q", str("duration"))
+		}
+		event.End = event.Start.Add(duration)
+	default:
+		return Event{}, errors.Wrap(ErrInvalidValue, "event needs an end or a duration")
+	}
+	if event.End.Before(event.Start) {
+		return Event{}, errors.Wrap(ErrInvalidValue, "event ends before it starts")
+	}
+
+	if organizer, ok := fields["organizer"].(map[string]any); ok {
+		if name, ok := organizer["name"].(string); ok {
+			event.Organizer.Name = name
+		}
+		if email, ok := organizer["email"].(string); ok {
+			event.Organizer.Email = email
+		}
+	}
+
+	// These values are written to the calendar file without escaping
+	for _, field := range []struct {
+		key   string
+		value string
+	}{
+		{"uid", event.UID},
+		{"url", event.URL},
+		{"organizer.name", event.Organizer.Name},
+		{"organizer.email", event.Organizer.Email},
+	} {
+		if strings.ContainsFunc(field.value, unicode.IsControl) {
+			return Event{}, errors.Wrapf(ErrInvalidValue, "event.%s contains control characters", field.key)
+		}
+	}
+
+	if event.UID == "" {
+		sum := sha256.Sum256([]byte(event.Title + "\x00" + event.Start.UTC().Format(time.RFC3339)))
+		event.UID = hex.EncodeToString(sum[:16]) + "@envelopr"
+	}
+	return event, nil
+}
+
+// WithEvent sets the variable holding the calendar event of a document. Without
+// it, documents have no event.
+func WithEvent(key string) RendererOption {
+	return func(r *Renderer) {
+		r.event = key
+	}
+}
+
+// Event returns the event of the template data, or nil if there is none.
+func (r *Renderer) Event(data any) (*Event, error) {
+	vars, ok := data.(map[string]any)
+	if !ok || r.event == "" || vars[r.event] == nil {
+		return nil, nil //nolint:nilnil
+	}
+	format, err := r.format.forData(data)
+	if err != nil {
+		return nil, err
+	}
+	event, err := ParseEvent(vars[r.event], format.location())
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// icsTime is the UTC time format of iCalendar files, times in UTC do not need
+// a time zone definition.
+const icsTime = "20060102T150405Z"
+
+// ICS returns the event as iCalendar file (RFC 5545). stamp is the creation
+// time of the file.
+func (e Event) ICS(stamp time.Time) []byte {
+	var b strings.Builder
+	line := func(content string) {
+		b.WriteString(foldLine(content))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//envelopr//envelopr//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("BEGIN:VEVENT")
+	line("UID:" + escapeICS(e.UID))
+	line("DTSTAMP:" + stamp.UTC().Format(icsTime))
+	line("DTSTART:" + e.Start.UTC().Format(icsTime))
+	line("DTEND:" + e.End.UTC().Format(icsTime))
+	line("SUMMARY:" + escapeICS(e.Title))
+	if e.Description != "" {
+		line("DESCRIPTION:" + escapeICS(e.Description))
+	}
+	if e.Location != "" {
+		line("LOCATION:" + escapeICS(e.Location))
+	}
+	if e.URL != "" {
+		line("URL:" + e.URL)
+	}
+	if e.Organizer.Email != "" {
+		organizer := "ORGANIZER"
+		if e.Organizer.Name != "" {
+			organizer += `;CN="` + strings.ReplaceAll(e.Organizer.Name, `"`, "'") + `"`
+		}
+		line(organizer + ":mailto:" + e.Organizer.Email)
+	}
+	line("END:VEVENT")
+	line("END:VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// escapeICS escapes text values of iCalendar properties.
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldLine splits lines longer than 75 bytes, continuation lines start with a
+// space. Lines are not split inside UTF-8 characters.
+func foldLine(s string) string {
+	const limit = 75
+
+	var b strings.Builder
+	for width := limit; len(s) > width; width = limit - 1 {
+		i := width
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		b.WriteString(s[:i])
+		b.WriteString("\r\n ")
+		s = s[i:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// calendarFuncs returns the functions creating links that add an event to
+// Google Calendar or Outlook:
+//
+//	<mj-button href="{{ googleCalendarUrl .event }}">Add to Google Calendar</mj-button>
+//	<mj-button href="{{ outlookCalendarUrl .event }}">Add to Outlook</mj-button>
+func calendarFuncs(format Format) template.FuncMap {
+	return template.FuncMap{
+		"googleCalendarUrl": func(value any) (string, error) {
+			event, err := ParseEvent(value, format.location())
+			if err != nil {
+				return "", err
+			}
+			query := url.Values{
+				"action": {"TEMPLATE"},
+				"text":   {event.Title},
+				"dates":  {event.Start.UTC().Format(icsTime) + "/" + event.End.UTC().Format(icsTime)},
+			}
+			if details := eventDetails(event); details != "" {
+				query.Set("details", details)
+			}
+			if event.Location != "" {
+				query.Set("location", event.Location)
+			}
+			return "https://calendar.google.com/calendar/render?" + query.Encode(), nil
+		},
+		"outlookCalendarUrl": func(value any) (string, error) {
+			event, err := ParseEvent(value, format.location())
+			if err != nil {
+				return "", err
+			}
+			query := url.Values{
+				"path":    {"/calendar/action/compose"},
+				"rru":     {"addevent"},
+				"subject": {event.Title},
+				"startdt": {event.Start.UTC().Format(time.RFC3339)},
+				"enddt":   {event.End.UTC().Format(time.RFC3339)},
+			}
+			if details := eventDetails(event); details != "" {
+				query.Set("body", details)
+			}
+			if event.Location != "" {
+				query.Set("location", event.Location)
+			}
+			return "https://outlook.live.com/calendar/0/deeplink/compose?" + query.Encode(), nil
+		},
+	}
+}
+
+// eventDetails is the description of an event followed by its URL, calendar
+// links have no field for the URL.
+func eventDetails(event Event) string {
+	if event.URL == "" {
+		return event.Description
+	}
+	if event.Description == "" {
+		return event.URL
+	}
+	return event.Description + "\n\n" + event.URL
+}
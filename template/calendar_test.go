@@ -0,0 +1,92 @@
+package template_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/config"
+	"github.com/esdete2/envelopr/template"
+)
+
+func TestParseEvent(t *testing.T) {
+	t.Run("times and defaults", func(t *testing.T) {
+		r := require.New(t)
+
+		event, err := template.ParseEvent(map[string]any{
+			"title":    "Launch",
+			"start":    "2024-05-01 15:00",
+			"end":      time.Date(2024, time.May, 1, 17, 0, 0, 0, time.UTC),
+			"timezone": "Europe/Berlin",
+		}, time.UTC)
+		r.NoError(err)
+		r.Equal(time.Date(2024, time.May, 1, 13, 0, 0, 0, time.UTC), event.Start.UTC())
+		r.Equal(time.Date(2024, time.May, 1, 17, 0, 0, 0, time.UTC), event.End.UTC())
+		r.True(strings.HasSuffix(event.UID, "@envelopr"))
+
+		again, err := template.ParseEvent(map[string]any{"title": "Launch", "start": "2024-05-01T13:00:00Z", "duration": "2h"}, time.UTC)
+		r.NoError(err)
+		r.Equal(event.UID, again.UID) // stable between builds
+	})
+
+	t.Run("invalid events", func(t *testing.T) {
+		r := require.New(t)
+
+		for _, fields := range []map[string]any{
+			{"start": "2024-05-01"},
+			{"title": "No end", "start": "2024-05-01"},
+			{"title": "Backwards", "start": "2024-05-01", "end": "2024-04-01"},
+			{"title": "Zone", "start": "2024-05-01", "duration": "1h", "timezone": "Mars/Olympus"},
+			{"title": "Link", "start": "2024-05-01", "duration": "1h", "url": "https://example.com\r\nATTACH:https://evil.example"},
+			{"title": "Mail", "start": "2024-05-01", "duration": "1h", "organizer": map[string]any{"email": "a@example.com\nX-EVIL:1"}},
+			{"title": "Name", "start": "2024-05-01", "duration": "1h", "organizer": map[string]any{"name": "ACME\r\nX-EVIL:1", "email": "a@example.com"}},
+		} {
+			_, err := template.ParseEvent(fields, time.UTC)
+			r.ErrorIs(err, template.ErrInvalidValue, fields)
+		}
+	})
+}
+
+func TestEvent_ICS(t *testing.T) {
+	r := require.New(t)
+
+	event := template.Event{
+		UID:         "webinar-42@example.com",
+		Title:       "Webinar; Q&A, live",
+		Description: "Line one\nLine two with a long text that has to be folded, because iCalendar lines are limited",
+		Location:    "Online",
+		URL:         "https://example.com/webinar",
+		Start:       time.Date(2024, time.May, 1, 13, 0, 0, 0, time.UTC),
+		End:         time.Date(2024, time.May, 1, 14, 0, 0, 0, time.UTC),
+		Organizer:   template.Organizer{Name: "ACME", Email: "events@example.com"},
+	}
+	ics := string(event.ICS(time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)))
+
+	r.True(strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	r.True(strings.HasSuffix(ics, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+	r.Contains(ics, "SUMMARY:Webinar\\; Q&A\\, live\r\n")
+	r.Contains(ics, "DESCRIPTION:Line one\\nLine two with a long text that has to be folded\\, bec\r\n ause iCalendar lines are limited\r\n")
+	for _, line := range strings.Split(ics, "\r\n") {
+		r.LessOrEqual(len(line), 75)
+	}
+}
+
+func TestCalendarFuncs(t *testing.T) {
+	r := require.New(t)
+
+	docs := []template.Template{{Name: "doc", Content: `{{ googleCalendarUrl .event }} {{ outlookCalendarUrl .event }}`}}
+	renderer := template.NewRenderer(docs, nil, template.WithEscape(config.EscapeNone))
+	result, err := renderer.Render("doc", map[string]any{
+		"event": map[string]any{
+			"title":    "Launch",
+			"start":    "2024-05-01T13:00:00Z",
+			"duration": "30m",
+			"location": "Berlin",
+		},
+	})
+	r.NoError(err)
+	r.Equal("https://calendar.google.com/calendar/render?action=TEMPLATE&dates=20240501T130000Z%2F20240501T133000Z&location=Berlin&text=Launch "+
+		"https://outlook.live.com/calendar/0/deeplink/compose?enddt=2024-05-01T13%3A30%3A00Z&location=Berlin&path=%2Fcalendar%2Faction%2Fcompose&rru=addevent&startdt=2024-05-01T13%3A00%3A00Z&subject=Launch", result)
+}
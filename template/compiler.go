@@ -19,21 +19,39 @@ func NewCompiler(config *config.Config) *Compiler {
 	}
 }
 
+// Compile compiles content with the MJML options of the config.
 func (c *Compiler) Compile(content string) (string, error) {
+	return c.CompileWithOptions(content, c.config.MJML)
+}
+
+// CompileDocument compiles the rendered content of a document with the MJML
+// options of the document.
+func (c *Compiler) CompileDocument(doc Template, content string) (string, error) {
+	return c.CompileWithOptions(content, c.Options(doc))
+}
+
+// Options returns the MJML options of a document. The config rules matching the
+// document are applied first, followed by the front matter of the document.
+func (c *Compiler) Options(doc Template) config.MJMLConfig {
+	return c.config.MJML.ForDocument(doc.Name).Apply(doc.FrontMatter.MJML)
+}
+
+// CompileWithOptions compiles content with the given MJML options.
+func (c *Compiler) CompileWithOptions(content string, cfg config.MJMLConfig) (string, error) {
 	// Convert config to MJML options
 	options := []mjml.ToHTMLOption{
-		mjml.WithMinify(c.config.MJML.Minify),
-		mjml.WithBeautify(c.config.MJML.Beautify),
-		mjml.WithKeepComments(c.config.MJML.KeepComments),
-		mjml.WithValidationLevel(mjml.ValidationLevel(c.config.MJML.ValidationLevel)),
+		mjml.WithMinify(cfg.Minify),
+		mjml.WithBeautify(cfg.Beautify),
+		mjml.WithKeepComments(cfg.KeepComments),
+		mjml.WithValidationLevel(mjml.ValidationLevel(cfg.ValidationLevel)),
 	}
 
-	if len(c.config.MJML.Fonts) > 0 {
-		options = append(options, mjml.WithFonts(c.config.MJML.Fonts))
+	if len(cfg.Fonts) > 0 {
+		options = append(options, mjml.WithFonts(cfg.Fonts))
 	}
 
-	// Compile MJML to HTML
-	html, err := mjml.ToHTML(context.Background(), content, options...)
+	// Compile MJML to HTML, keeping Outlook conditional comments intact
+	html, err := mjml.ToHTML(context.Background(), protectConditionalComments(content), options...)
 	if err != nil {
 		return "", errors.Wrap(err, "compiling MJML")
 	}
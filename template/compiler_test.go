@@ -97,4 +97,103 @@ func TestCompiler(t *testing.T) {
 		r.ErrorAs(err, &mjmlError)
 		r.Empty(result)
 	})
+
+	t.Run("per-document options", func(t *testing.T) {
+		strict := true
+		cfg := &config.Config{
+			MJML: config.MJMLConfig{
+				ValidationLevel: "soft",
+				Fonts: map[string]string{
+					"Roboto": "https://fonts.googleapis.com/css?family=Roboto",
+				},
+				Documents: map[string]config.MJMLOverride{
+					"transactional":   {ValidationLevel: "strict", Minify: &strict},
+					"transactional/*": {Fonts: map[string]string{"Lato": "https://fonts.googleapis.com/css?family=Lato"}},
+					"newsletter":      {ValidationLevel: "skip"},
+				},
+			},
+		}
+		compiler := template.NewCompiler(cfg)
+
+		options := compiler.Options(template.Template{Name: "transactional/receipt"})
+		r.Equal("strict", options.ValidationLevel)
+		r.True(options.Minify)
+		r.Len(options.Fonts, 2)
+		r.Len(cfg.MJML.Fonts, 1)
+
+		options = compiler.Options(template.Template{Name: "newsletter"})
+		r.Equal("skip", options.ValidationLevel)
+		r.False(options.Minify)
+
+		// Front matter is applied last
+		options = compiler.Options(template.Template{
+			Name: "transactional/receipt",
+			FrontMatter: template.FrontMatter{
+				MJML: config.MJMLOverride{ValidationLevel: "soft"},
+			},
+		})
+		r.Equal("soft", options.ValidationLevel)
+		r.True(options.Minify)
+
+		input := `<mjml><mj-body><invalid-tag></invalid-tag></mj-body></mjml>`
+		_, err := compiler.CompileDocument(template.Template{Name: "newsletter"}, input)
+		r.NoError(err)
+		_, err = compiler.CompileDocument(template.Template{Name: "transactional/receipt"}, input)
+		r.Error(err)
+	})
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	t.Run("without front matter", func(t *testing.T) {
+		r := require.New(t)
+
+		frontMatter, body, err := template.ParseFrontMatter("<mjml></mjml>")
+		r.NoError(err)
+		r.Equal(template.FrontMatter{}, frontMatter)
+		r.Equal("<mjml></mjml>", body)
+	})
+
+	t.Run("keeps line numbers", func(t *testing.T) {
+		r := require.New(t)
+
+		frontMatter, body, err := template.ParseFrontMatter(`---
+mjml:
+  validationLevel: strict
+  minify: false
+---
+<mjml>
+{{ .missing.field }}
+</mjml>`)
+		r.NoError(err)
+		r.Equal("strict", frontMatter.MJML.ValidationLevel)
+		r.NotNil(frontMatter.MJML.Minify)
+		r.False(*frontMatter.MJML.Minify)
+
+		renderer := template.NewRenderer([]template.Template{{Name: "doc", Content: body}}, nil)
+		rendered, err := renderer.Render("doc", map[string]any{"missing": map[string]any{}})
+		r.NoError(err)
+		r.Equal("<mjml>\n\n</mjml>", rendered) // missing values are empty when escaped
+
+		_, err = renderer.Render("doc", map[string]any{"missing": "text"})
+		r.ErrorContains(err, "doc:7:")
+	})
+
+	t.Run("invalid front matter", func(t *testing.T) {
+		r := require.New(t)
+
+		_, _, err := template.ParseFrontMatter("---\nmjml:\n  minfy: true\n---\n<mjml></mjml>")
+		r.ErrorIs(err, template.ErrInvalidFrontMatter)
+
+		_, _, err = template.ParseFrontMatter("---\nmjml:\n  validationLevel: lenient\n---\n")
+		r.ErrorIs(err, template.ErrInvalidFrontMatter)
+
+		_, _, err = template.ParseFrontMatter("---\nmjml: {}\n<mjml></mjml>")
+		r.ErrorIs(err, template.ErrInvalidFrontMatter)
+
+		_, _, err = template.ParseFrontMatter("---\nparams:\n  - name: url\n    type: link\n---\n")
+		r.ErrorContains(err, `params[0].type: invalid value "link"`)
+
+		_, _, err = template.ParseFrontMatter("---\nparams:\n  - name: width\n    type: number\n    default: wide\n---\n")
+		r.ErrorContains(err, "params[0].default: expected a number")
+	})
 }
@@ -0,0 +1,512 @@
+package template
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/friendsofgo/errors"
+)
+
+// HTML is a value that is written to the output without escaping, e.g. the
+// result of safe or expression.
+type HTML string
+
+var ErrEscaping = errors.New("cannot escape template")
+
+// Escape functions added to the pipelines of actions, depending on the context
+// the action is in.
+const (
+	escapeTextFunc        = "_envelopr_escape_text"
+	escapeAttrFunc        = "_envelopr_escape_attr"
+	escapeUnquotedFunc    = "_envelopr_escape_unquoted"
+	escapeURLFunc         = "_envelopr_escape_url"
+	escapeURLUnquotedFunc = "_envelopr_escape_url_unquoted"
+	escapeCSSFunc         = "_envelopr_escape_css"
+	escapeScriptFunc      = "_envelopr_escape_script"
+)
+
+// unsafeURL replaces URLs with a scheme that could run code, like in
+// html/template.
+const unsafeURL = "#ZgotmplZ"
+
+// escapeFuncs returns the escape functions and the functions to opt out of
+// escaping.
+func escapeFuncs() template.FuncMap {
+	safe := func(value any) HTML {
+		if h, ok := value.(HTML); ok {
+			return h
+		}
+		return HTML(fmt.Sprint(value))
+	}
+
+	return template.FuncMap{
+		"safe": safe,
+		"raw":  safe,
+
+		escapeTextFunc: escaper(func(s string) string {
+			return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+		}),
+		escapeAttrFunc:     escaper(html.EscapeString),
+		escapeUnquotedFunc: escaper(escapeUnquoted),
+		escapeURLFunc: escaper(func(s string) string {
+			return html.EscapeString(filterURL(s))
+		}),
+		escapeURLUnquotedFunc: escaper(func(s string) string {
+			return escapeUnquoted(filterURL(s))
+		}),
+		// Style elements are not HTML, only the start of a closing tag is
+		// escaped, as CSS escape
+		escapeCSSFunc: escaper(func(s string) string {
+			return strings.ReplaceAll(s, "<", `\3c `)
+		}),
+		escapeScriptFunc: func(args ...any) (HTML, error) {
+			if len(args) == 1 {
+				if h, ok := args[0].(HTML); ok {
+					return h, nil
+				}
+			}
+			return "", errors.Wrap(ErrEscaping, "values in scripts have to be marked safe")
+		},
+	}
+}
+
+// escaper returns a template function that escapes the value of a pipeline
+// with fn, unless it is HTML. Missing values are written as empty string.
+func escaper(fn func(string) string) func(...any) HTML {
+	return func(args ...any) HTML {
+		if len(args) == 1 {
+			switch value := args[0].(type) {
+			case HTML:
+				return value
+			case nil:
+				return ""
+			}
+		}
+		return HTML(fn(fmt.Sprint(args...)))
+	}
+}
+
+func escapeUnquoted(s string) string {
+	return strings.NewReplacer(
+		"&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;", "'", "&#39;",
+		"`", "&#96;", "=", "&#61;", " ", "&#32;", "\t", "&#9;", "\n", "&#10;", "\r", "&#13;",
+	).Replace(s)
+}
+
+// filterURL replaces URLs with schemes other than the ones used in emails.
+// Relative URLs and preserved expressions like {{ .url }} are kept.
+func filterURL(s string) string {
+	scheme, _, found := strings.Cut(strings.TrimSpace(s), ":")
+	if !found || strings.ContainsAny(scheme, "/?#{ ") {
+		return s
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto", "tel", "sms", "cid":
+		return s
+	}
+	return unsafeURL
+}
+
+type escapeState int
+
+const (
+	stateText escapeState = iota
+	stateComment
+	// stateTag is inside a start tag, before an attribute name
+	stateTag
+	stateAttrName
+	stateAfterAttrName
+	stateBeforeValue
+	stateAttrValue
+	// stateCSS is inside a style element, stateScript inside a script element
+	stateCSS
+	stateScript
+)
+
+// escapeContext is the position in the HTML output of a template.
+type escapeContext struct {
+	state escapeState
+	// delim is the quote of the current attribute value, 0 if unquoted
+	delim byte
+	// url is set if the current attribute holds a URL
+	url bool
+	// element is the name of the style or script element of the current tag
+	// or content, empty for other elements
+	element string
+}
+
+// String returns the context as suffix of the names of escaped templates.
+func (c escapeContext) String() string {
+	return fmt.Sprintf("%d_%d_%t_%s", c.state, c.delim, c.url, c.element)
+}
+
+// escapeFunc returns the escape function for an action in the context.
+func (c escapeContext) escapeFunc() string {
+	switch c.state {
+	case stateText, stateComment:
+		return escapeTextFunc
+	case stateAttrValue:
+		switch {
+		case c.url && c.delim != 0:
+			return escapeURLFunc
+		case c.url:
+			return escapeURLUnquotedFunc
+		case c.delim != 0:
+			return escapeAttrFunc
+		}
+		return escapeUnquotedFunc
+	case stateBeforeValue:
+		if c.url {
+			return escapeURLUnquotedFunc
+		}
+		return escapeUnquotedFunc
+	case stateTag, stateAttrName, stateAfterAttrName:
+		return escapeUnquotedFunc
+	case stateCSS:
+		return escapeCSSFunc
+	case stateScript:
+		return escapeScriptFunc
+	}
+	return escapeUnquotedFunc
+}
+
+// scan returns the context after text.
+func (c escapeContext) scan(text string) escapeContext {
+	for i := 0; i < len(text); {
+		switch c.state {
+		case stateText:
+			j := strings.IndexByte(text[i:], '<')
+			if j < 0 {
+				return c
+			}
+			i += j
+			switch {
+			case strings.HasPrefix(text[i:], "<!--"):
+				c.state = stateComment
+				i += len("<!--")
+			case i+1 < len(text) && isLetter(text[i+1]):
+				j := skipName(text, i+1)
+				c = escapeContext{state: stateTag, element: rawTextElement(text[i+1 : j])}
+				i = j
+			case i+1 < len(text) && text[i+1] == '/':
+				c.state = stateTag
+				i = skipName(text, i+2)
+			default:
+				i++
+			}
+		case stateComment:
+			j := strings.Index(text[i:], "-->")
+			if j < 0 {
+				return c
+			}
+			c.state = stateText
+			i += j + len("-->")
+		case stateCSS, stateScript:
+			// The content ends at the closing tag of the element only
+			end := "</" + c.element
+			j := indexFold(text[i:], end)
+			if j < 0 {
+				return c
+			}
+			c = escapeContext{state: stateTag}
+			i += j + len(end)
+		case stateTag:
+			switch b := text[i]; {
+			case b == '>':
+				c = c.afterTag()
+				i++
+			case isSpace(b) || b == '/':
+				i++
+			default:
+				j := skipName(text, i)
+				if j == i {
+					j++
+				}
+				c.state = stateAttrName
+				c.url = isURLAttr(text[i:j])
+				i = j
+			}
+		case stateAttrName:
+			c.state = stateAfterAttrName
+		case stateAfterAttrName:
+			switch b := text[i]; {
+			case isSpace(b):
+				i++
+			case b == '=':
+				c.state = stateBeforeValue
+				i++
+			default:
+				c.state = stateTag
+			}
+		case stateBeforeValue:
+			switch b := text[i]; {
+			case isSpace(b):
+				i++
+			case b == '"' || b == '\'':
+				c.state, c.delim = stateAttrValue, b
+				i++
+			case b == '>':
+				c = c.afterTag()
+				i++
+			default:
+				c.state, c.delim = stateAttrValue, 0
+			}
+		case stateAttrValue:
+			if c.delim != 0 {
+				j := strings.IndexByte(text[i:], c.delim)
+				if j < 0 {
+					return c
+				}
+				c = escapeContext{state: stateTag, element: c.element}
+				i += j + 1
+				continue
+			}
+			j := strings.IndexFunc(text[i:], func(r rune) bool {
+				return r == '>' || r < 0x80 && isSpace(byte(r))
+			})
+			if j < 0 {
+				return c
+			}
+			c = escapeContext{state: stateTag, element: c.element}
+			i += j
+		}
+	}
+	return c
+}
+
+// afterTag returns the context after the end of a tag, the content of style
+// and script elements is not HTML.
+func (c escapeContext) afterTag() escapeContext {
+	switch c.element {
+	case "style", "mj-style":
+		return escapeContext{state: stateCSS, element: c.element}
+	case "script":
+		return escapeContext{state: stateScript, element: c.element}
+	}
+	return escapeContext{}
+}
+
+// rawTextElement returns the lower case name of a style or script element,
+// an empty string for other elements.
+func rawTextElement(name string) string {
+	name = strings.ToLower(name)
+	switch name {
+	case "style", "mj-style", "script":
+		return name
+	}
+	return ""
+}
+
+// afterAction returns the context after the output of an action.
+func (c escapeContext) afterAction() escapeContext {
+	switch c.state {
+	case stateBeforeValue:
+		// The action starts an unquoted attribute value
+		c.state, c.delim = stateAttrValue, 0
+	case stateTag:
+		c.state = stateAttrName
+	}
+	return c
+}
+
+// indexFold returns the index of the first ASCII case-insensitive match of
+// substr in s, or -1.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isLetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// skipName returns the index after the tag or attribute name starting at i.
+func skipName(text string, i int) int {
+	for i < len(text) && !isSpace(text[i]) && !strings.ContainsRune("=>/\"'", rune(text[i])) {
+		i++
+	}
+	return i
+}
+
+// isURLAttr reports whether an attribute of HTML or MJML holds a URL.
+func isURLAttr(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "href", "src", "action", "background", "cite", "poster", "icon":
+		return true
+	}
+	return strings.HasSuffix(name, "-url") || strings.HasSuffix(name, "-href") ||
+		strings.HasSuffix(name, "-src") || strings.HasSuffix(name, ":href")
+}
+
+// escapeTemplates adds escape functions to the printing actions of the
+// document and the head fragments, which start in text context. Like in
+// html/template, a template called in another context is escaped in a copy
+// named after the context, so that partials are escaped where they are called.
+func escapeTemplates(tmpl *template.Template) error {
+	e := &templateEscaper{
+		tmpl:      tmpl,
+		originals: make(map[string]*parse.Tree),
+		ends:      make(map[escapedTemplate]escapeContext),
+		pending:   make(map[escapedTemplate]bool),
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			e.originals[t.Name()] = t.Tree.Copy()
+		}
+	}
+
+	for _, name := range []string{tmpl.Name(), headTemplate} {
+		if _, ok := e.originals[name]; !ok {
+			continue
+		}
+		if _, _, err := e.escapeTemplate(name, escapeContext{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapedSeparator separates the name of a template from the context of a
+// copy escaped for another context.
+const escapedSeparator = "$envelopr_"
+
+// unescapedName returns the name of the template an escaped copy was made of.
+func unescapedName(name string) string {
+	name, _, _ = strings.Cut(name, escapedSeparator)
+	return name
+}
+
+// escapedTemplate is a template escaped for the context it starts in.
+type escapedTemplate struct {
+	name    string
+	context escapeContext
+}
+
+// templateEscaper escapes the templates of a set in the contexts they are
+// called in.
+type templateEscaper struct {
+	tmpl *template.Template
+	// originals are the trees of the templates before escaping
+	originals map[string]*parse.Tree
+	// ends are the contexts at the end of the escaped templates
+	ends map[escapedTemplate]escapeContext
+	// pending are the templates being escaped, set once they are called
+	// recursively
+	pending map[escapedTemplate]bool
+}
+
+// escapeTemplate escapes the template with the name for the context it starts
+// in, and returns the name of the escaped template and the context at its end.
+func (e *templateEscaper) escapeTemplate(name string, c escapeContext) (string, escapeContext, error) {
+	key := escapedTemplate{name: name, context: c}
+	escaped := name
+	if c != (escapeContext{}) {
+		escaped = name + escapedSeparator + c.String()
+	}
+	if end, ok := e.ends[key]; ok {
+		if _, ok := e.pending[key]; ok {
+			e.pending[key] = true
+		}
+		return escaped, end, nil
+	}
+
+	// Recursive calls are assumed to end in the context they start in
+	e.ends[key] = c
+	e.pending[key] = false
+	tree := e.originals[name].Copy()
+	end, err := e.escapeList(tree, tree.Root, c)
+	if err != nil {
+		return escaped, c, err
+	}
+	if e.pending[key] && end != c {
+		return escaped, c, errors.Wrapf(ErrEscaping, "%s: recursive template ends in a different HTML context", name)
+	}
+	delete(e.pending, key)
+	e.ends[key] = end
+
+	if _, err := e.tmpl.AddParseTree(escaped, tree); err != nil {
+		return escaped, c, errors.Wrapf(ErrEscaping, "%s: %v", name, err)
+	}
+	return escaped, end, nil
+}
+
+// escapeList escapes the actions of a list and returns the context after it.
+func (e *templateEscaper) escapeList(tree *parse.Tree, list *parse.ListNode, c escapeContext) (escapeContext, error) {
+	if list == nil {
+		return c, nil
+	}
+
+	var err error
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.TextNode:
+			c = c.scan(string(node.Text))
+		case *parse.ActionNode:
+			// Assignments do not print anything
+			if len(node.Pipe.Decl) > 0 {
+				continue
+			}
+			escapePipe(tree, node.Pipe, c.escapeFunc())
+			c = c.afterAction()
+		case *parse.TemplateNode:
+			// Missing templates fail when executed
+			if _, ok := e.originals[node.Name]; ok {
+				node.Name, c, err = e.escapeTemplate(node.Name, c)
+			}
+		case *parse.IfNode:
+			c, err = e.escapeBranch(tree, node, &node.BranchNode, c)
+		case *parse.RangeNode:
+			c, err = e.escapeBranch(tree, node, &node.BranchNode, c)
+		case *parse.WithNode:
+			c, err = e.escapeBranch(tree, node, &node.BranchNode, c)
+		case *parse.ListNode:
+			c, err = e.escapeList(tree, node, c)
+		}
+		if err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// escapeBranch escapes both branches of an if, range or with action, which have
+// to end in the same context.
+func (e *templateEscaper) escapeBranch(tree *parse.Tree, node parse.Node, branch *parse.BranchNode, c escapeContext) (escapeContext, error) {
+	after, err := e.escapeList(tree, branch.List, c)
+	if err != nil {
+		return c, err
+	}
+	afterElse, err := e.escapeList(tree, branch.ElseList, c)
+	if err != nil {
+		return c, err
+	}
+
+	_, isRange := node.(*parse.RangeNode)
+	if after != afterElse || isRange && after != c {
+		location, _ := tree.ErrorContext(node)
+		return c, errors.Wrapf(ErrEscaping, "%s: branches end in different HTML contexts", location)
+	}
+	return after, nil
+}
+
+// escapePipe appends the escape function to a pipeline.
+func escapePipe(tree *parse.Tree, pipe *parse.PipeNode, fn string) {
+	ident := parse.NewIdentifier(fn).SetTree(tree).SetPos(pipe.Pos)
+	pipe.Cmds = append(pipe.Cmds, &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      pipe.Pos,
+		Args:     []parse.Node{ident},
+	})
+}
@@ -0,0 +1,488 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/friendsofgo/errors"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+var ErrInvalidValue = errors.New("invalid value")
+
+// Format holds the settings of the formatting functions.
+type Format struct {
+	// Locale of the formatted values, e.g. de-DE, English is used if empty
+	Locale string
+	// Location is the time zone of formatted times, UTC is used if nil
+	Location *time.Location
+	// Now is the time returned by now, the current time is used if zero
+	Now time.Time
+}
+
+// WithFormat sets the settings of the formatting functions. Documents override
+// the locale with a "locale" variable and the time zone with a "timezone"
+// variable.
+func WithFormat(format Format) RendererOption {
+	return func(r *Renderer) {
+		r.format = format
+	}
+}
+
+// forData applies the locale and timezone variables of the template data.
+func (f Format) forData(data any) (Format, error) {
+	vars, ok := data.(map[string]any)
+	if !ok {
+		return f, nil
+	}
+	if locale, ok := vars["locale"].(string); ok && locale != "" {
+		f.Locale = locale
+	}
+	if timezone, ok := vars["timezone"].(string); ok && timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return f, errors.Wrapf(ErrInvalidValue, "timezone variable %q", timezone)
+		}
+		f.Location = location
+	}
+	return f, nil
+}
+
+func (f Format) tag() language.Tag {
+	tag, err := language.Parse(strings.ReplaceAll(f.Locale, "_", "-"))
+	if err != nil || tag == language.Und {
+		return language.AmericanEnglish
+	}
+	return tag
+}
+
+func (f Format) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+	return f.Location
+}
+
+// FormatFuncs returns the formatting functions for the locale and time zone of
+// format. They are available in all documents, and can be added to the
+// function map of templates executed at runtime, e.g. for preserved
+// expressions, to format values the same way:
+//
+//	{{ number .amount }}            1,234.5
+//	{{ number 2 .amount }}          1,234.50
+//	{{ number .price }}             10.00 for the decimal 10.00, keeping its scale
+//	{{ percent .rate }}             26%
+//	{{ currency "EUR" .total }}     €1,234.50, or 1.234,50 € in de-DE
+//	{{ date .created }}             1/2/06, also "medium", "long" or a Go layout
+//	{{ time .created }}             3:04 PM, also "medium" or a Go layout
+//	{{ datetime .created }}         1/2/06, 3:04 PM
+//	{{ inZone "Europe/Berlin" now }}
+//
+// Month and weekday names are translated for de, es, fr, it, nl and pt, other
+// languages use the English names.
+func FormatFuncs(format Format) template.FuncMap {
+	tag := format.tag()
+	printer := message.NewPrinter(tag)
+	patterns := datePatternsFor(tag)
+	separator, exact := decimalSeparator(printer)
+	minus := minusSign(printer)
+
+	// formatDecimal writes decimals digit by digit, so that no precision is
+	// lost by converting them to floats
+	formatDecimal := func(d config.Decimal) string {
+		integer, fraction := d.Parts()
+		i, err := strconv.ParseUint(integer, 10, 64)
+		if !exact || err != nil {
+			return printer.Sprint(number.Decimal(d.Float64(), fractionDigits(d.Scale(), 0)...))
+		}
+		s := printer.Sprint(number.Decimal(i))
+		if fraction != "" {
+			s += separator + fraction
+		}
+		if d.Negative() {
+			s = minus + s
+		}
+		return s
+	}
+
+	formatTime := func(args []any, layouts map[string]string, fallback string) (string, error) {
+		layout, value, err := layoutArgs(args, layouts, fallback)
+		if err != nil {
+			return "", err
+		}
+		t, err := toTime(value, format.location())
+		if err != nil {
+			return "", err
+		}
+		return localizeNames(t, layout, tag), nil
+	}
+
+	return template.FuncMap{
+		"number": func(args ...any) (string, error) {
+			digits, value, err := digitsArgs(args, -1)
+			if err != nil {
+				return "", err
+			}
+			if d, ok := value.(config.Decimal); ok {
+				if digits < 0 {
+					digits = d.Scale()
+				}
+				return formatDecimal(d.Round(digits)), nil
+			}
+			f, err := toFloat(value)
+			if err != nil {
+				return "", err
+			}
+			return printer.Sprint(number.Decimal(round(f, digits), fractionDigits(digits, 3)...)), nil
+		},
+		"percent": func(args ...any) (string, error) {
+			digits, value, err := digitsArgs(args, 0)
+			if err != nil {
+				return "", err
+			}
+			f, err := toFloat(value)
+			if err != nil {
+				return "", err
+			}
+			return printer.Sprint(number.Percent(round(f, digits+2), fractionDigits(digits, 0)...)), nil
+		},
+		"currency": func(code string, value any) (string, error) {
+			unit, err := currency.ParseISO(code)
+			if err != nil {
+				return "", errors.Wrapf(ErrInvalidValue, "currency code %q", code)
+			}
+			scale, _ := currency.Standard.Rounding(unit)
+			var amount string
+			if d, ok := value.(config.Decimal); ok {
+				amount = formatDecimal(d.Round(scale))
+			} else {
+				f, err := toFloat(value)
+				if err != nil {
+					return "", err
+				}
+				amount = printer.Sprint(number.Decimal(round(f, scale), number.MinFractionDigits(scale), number.MaxFractionDigits(scale)))
+			}
+			return placeSymbol(tag, printer.Sprint(currency.Symbol(unit)), amount), nil
+		},
+		"date": func(args ...any) (string, error) {
+			return formatTime(args, map[string]string{
+				"short":  patterns.short,
+				"medium": patterns.medium,
+				"long":   patterns.long,
+			}, patterns.short)
+		},
+		"time": func(args ...any) (string, error) {
+			return formatTime(args, map[string]string{
+				"short":  patterns.time,
+				"medium": patterns.timeMedium,
+			}, patterns.time)
+		},
+		"datetime": func(args ...any) (string, error) {
+			return formatTime(args, map[string]string{
+				"short":  patterns.short + ", " + patterns.time,
+				"medium": patterns.medium + ", " + patterns.time,
+				"long":   patterns.long + ", " + patterns.time,
+			}, patterns.short+", "+patterns.time)
+		},
+		"inZone": func(name string, value any) (time.Time, error) {
+			location, err := time.LoadLocation(name)
+			if err != nil {
+				return time.Time{}, errors.Wrapf(ErrInvalidValue, "timezone %q", name)
+			}
+			t, err := toTime(value, format.location())
+			if err != nil {
+				return time.Time{}, err
+			}
+			return t.In(location), nil
+		},
+		"now": func() time.Time {
+			if format.Now.IsZero() {
+				return time.Now().In(format.location())
+			}
+			return format.Now.In(format.location())
+		},
+	}
+}
+
+// digitsArgs splits the arguments of a number function into the optional number
+// of fraction digits and the value.
+func digitsArgs(args []any, fallback int) (int, any, error) {
+	switch len(args) {
+	case 1:
+		return fallback, args[0], nil
+	case 2:
+		digits, ok := args[0].(int)
+		if !ok || digits < 0 {
+			return 0, nil, errors.Wrapf(ErrInvalidValue, "fraction digits %v", args[0])
+		}
+		return digits, args[1], nil
+	}
+	return 0, nil, errors.Wrapf(ErrInvalidValue, "expected a value and optional fraction digits, got %d arguments", len(args))
+}
+
+// fractionDigits returns the options for a fixed number of fraction digits, or
+// up to maximum digits if digits is negative.
+func fractionDigits(digits, maximum int) []number.Option {
+	if digits < 0 {
+		return []number.Option{number.MaxFractionDigits(maximum)}
+	}
+	return []number.Option{number.MinFractionDigits(digits), number.MaxFractionDigits(digits)}
+}
+
+// decimalSeparator returns the decimal separator of the printer. It is not
+// exact for locales that do not use ASCII digits.
+func decimalSeparator(printer *message.Printer) (string, bool) {
+	sample := printer.Sprint(number.Decimal(1.5, number.MinFractionDigits(1)))
+	if len(sample) < 3 || sample[0] != '1' || sample[len(sample)-1] != '5' {
+		return "", false
+	}
+	return sample[1 : len(sample)-1], true
+}
+
+// minusSign returns the sign the printer writes before negative numbers, e.g.
+// U+2212 in Swedish.
+func minusSign(printer *message.Printer) string {
+	if sign, ok := strings.CutSuffix(printer.Sprint(number.Decimal(-1)), "1"); ok && sign != "" {
+		return sign
+	}
+	return "-"
+}
+
+// round rounds f to digits fraction digits, halves away from zero as expected
+// for amounts. Negative digits keep f unchanged.
+func round(f float64, digits int) float64 {
+	if digits < 0 {
+		return f
+	}
+	// Rounding the shortest decimal of f keeps 1.005 from becoming 1.00, the
+	// float is slightly below 1.005
+	d, err := config.ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return f // NaN and infinity
+	}
+	return d.Round(digits).Float64()
+}
+
+// layoutArgs splits the arguments of a time function into the layout and the
+// value. The layout is a style name or a Go time layout.
+func layoutArgs(args []any, layouts map[string]string, fallback string) (string, any, error) {
+	switch len(args) {
+	case 1:
+		return fallback, args[0], nil
+	case 2:
+		layout, ok := args[0].(string)
+		if !ok {
+			return "", nil, errors.Wrapf(ErrInvalidValue, "layout %v", args[0])
+		}
+		if style, ok := layouts[layout]; ok {
+			layout = style
+		}
+		return layout, args[1], nil
+	}
+	return "", nil, errors.Wrapf(ErrInvalidValue, "expected a value and an optional layout, got %d arguments", len(args))
+}
+
+// toFloat converts numbers and numeric strings.
+func toFloat(value any) (float64, error) {
+	if s, ok := value.(fmt.Stringer); ok {
+		value = s.String()
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+		if err == nil {
+			return f, nil
+		}
+	}
+	return 0, errors.Wrapf(ErrInvalidValue, "expected a number, got %v", value)
+}
+
+// timeLayouts are the layouts of times given as strings.
+//
+//nolint:gochecknoglobals
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// toTime converts times, strings in RFC 3339 or ISO date format and Unix
+// timestamps in seconds. Times keep their zone, the others are converted to
+// location, strings without zone are in location.
+func toTime(value any, location *time.Location) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, strings.TrimSpace(v), location); err == nil {
+				return t.In(location), nil
+			}
+		}
+	case int:
+		return time.Unix(int64(v), 0).In(location), nil
+	case int64:
+		return time.Unix(v, 0).In(location), nil
+	case float64:
+		return time.Unix(int64(v), 0).In(location), nil
+	}
+	return time.Time{}, errors.Wrapf(ErrInvalidValue, "expected a time, got %v", value)
+}
+
+// suffixSymbolLanguages write the currency symbol after the amount.
+//
+//nolint:gochecknoglobals
+var suffixSymbolLanguages = map[string]bool{
+	"bg": true, "cs": true, "da": true, "de": true, "el": true, "es": true, "et": true, "fi": true, "fr": true,
+	"hr": true, "hu": true, "it": true, "lt": true, "lv": true, "nb": true, "no": true, "pl": true, "ro": true,
+	"ru": true, "sk": true, "sl": true, "sv": true, "uk": true,
+}
+
+// placeSymbol combines a currency symbol and a formatted amount the way the
+// locale writes it, separated by a no-break space like the number separators.
+func placeSymbol(tag language.Tag, symbol, amount string) string {
+	base, _ := tag.Base()
+	region, _ := tag.Region()
+
+	switch {
+	case suffixSymbolLanguages[base.String()] && region.String() != "CH" && region.String() != "AT":
+		return amount + " " + symbol
+	case base.String() == "en" || base.String() == "ja" || base.String() == "zh" || base.String() == "ko":
+		return symbol + amount
+	}
+	return symbol + " " + amount
+}
+
+// datePatterns are the Go layouts of the date and time styles of a locale.
+type datePatterns struct {
+	short, medium, long string
+	time, timeMedium    string
+}
+
+// localDatePatterns by language, English uses the American patterns for the US
+// and the British ones elsewhere.
+//
+//nolint:gochecknoglobals
+var localDatePatterns = map[string]datePatterns{
+	"en-US": {"1/2/06", "Jan 2, 2006", "January 2, 2006", "3:04 PM", "3:04:05 PM"},
+	"en":    {"02/01/2006", "2 Jan 2006", "2 January 2006", "15:04", "15:04:05"},
+	"de":    {"02.01.06", "02.01.2006", "2. January 2006", "15:04", "15:04:05"},
+	"fr":    {"02/01/2006", "2 Jan 2006", "2 January 2006", "15:04", "15:04:05"},
+	"es":    {"2/1/06", "2 Jan 2006", "2 de January de 2006", "15:04", "15:04:05"},
+	"it":    {"02/01/06", "2 Jan 2006", "2 January 2006", "15:04", "15:04:05"},
+	"nl":    {"02-01-2006", "2 Jan 2006", "2 January 2006", "15:04", "15:04:05"},
+	"pt":    {"02/01/2006", "2 de Jan de 2006", "2 de January de 2006", "15:04", "15:04:05"},
+}
+
+// fallbackDatePatterns are used for other languages.
+//
+//nolint:gochecknoglobals
+var fallbackDatePatterns = datePatterns{"2006-01-02", "2 Jan 2006", "2 January 2006", "15:04", "15:04:05"}
+
+func datePatternsFor(tag language.Tag) datePatterns {
+	base, _ := tag.Base()
+	region, _ := tag.Region()
+	if patterns, ok := localDatePatterns[base.String()+"-"+region.String()]; ok {
+		return patterns
+	}
+	if patterns, ok := localDatePatterns[base.String()]; ok {
+		return patterns
+	}
+	return fallbackDatePatterns
+}
+
+// dateNames are the full and abbreviated month and weekday names of a
+// language, weekdays start on Sunday like time.Weekday.
+type dateNames struct {
+	months, shortMonths     [12]string
+	weekdays, shortWeekdays [7]string
+}
+
+// localDateNames by language, other languages use the English names.
+//
+//nolint:gochecknoglobals
+var localDateNames = map[string]dateNames{
+	"de": {
+		months:        [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths:   [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		weekdays:      [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortWeekdays: [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+	},
+	"fr": {
+		months:        [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths:   [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		weekdays:      [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortWeekdays: [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	},
+	"es": {
+		months:        [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths:   [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		weekdays:      [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortWeekdays: [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	},
+	"it": {
+		months:        [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		shortMonths:   [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		weekdays:      [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		shortWeekdays: [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	},
+	"nl": {
+		months:        [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		shortMonths:   [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		weekdays:      [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		shortWeekdays: [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+	},
+	"pt": {
+		months:        [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		shortMonths:   [12]string{"jan.", "fev.", "mar.", "abr.", "mai.", "jun.", "jul.", "ago.", "set.", "out.", "nov.", "dez."},
+		weekdays:      [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		shortWeekdays: [7]string{"dom.", "seg.", "ter.", "qua.", "qui.", "sex.", "sáb."},
+	},
+}
+
+// Placeholders for month and weekday names, they are not layout elements and
+// are kept by time.Format.
+const (
+	longMonthPlaceholder    = "\x00"
+	shortMonthPlaceholder   = "\x01"
+	longWeekdayPlaceholder  = "\x02"
+	shortWeekdayPlaceholder = "\x03"
+)
+
+// localizeNames formats t with layout and the month and weekday names of the
+// language.
+func localizeNames(t time.Time, layout string, tag language.Tag) string {
+	base, _ := tag.Base()
+	names, ok := localDateNames[base.String()]
+	if !ok {
+		return t.Format(layout)
+	}
+
+	layout = strings.ReplaceAll(layout, "January", longMonthPlaceholder)
+	layout = strings.ReplaceAll(layout, "Jan", shortMonthPlaceholder)
+	layout = strings.ReplaceAll(layout, "Monday", longWeekdayPlaceholder)
+	layout = strings.ReplaceAll(layout, "Mon", shortWeekdayPlaceholder)
+	return strings.NewReplacer(
+		longMonthPlaceholder, names.months[t.Month()-1],
+		shortMonthPlaceholder, names.shortMonths[t.Month()-1],
+		longWeekdayPlaceholder, names.weekdays[t.Weekday()],
+		shortWeekdayPlaceholder, names.shortWeekdays[t.Weekday()],
+	).Replace(t.Format(layout))
+}
@@ -0,0 +1,114 @@
+package template_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/config"
+	"github.com/esdete2/envelopr/template"
+)
+
+func TestFormatFuncs(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	now := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		locale   string
+		content  string
+		expected string
+	}{
+		{"en-US", `{{ number .amount }}`, "1,234.5"},
+		{"en-US", `{{ number 2 .amount }}`, "1,234.50"},
+		{"de-DE", `{{ .amount | number 2 }}`, "1.234,50"},
+		{"en-US", `{{ number "10.00" }}`, "10"},
+		{"en-US", `{{ percent .rate }}`, "26%"},
+		{"de-DE", `{{ percent 1 .rate }}`, "25,6\u00a0%"},
+		{"en-US", `{{ currency "EUR" .amount }}`, "€1,234.50"},
+		{"de-DE", `{{ currency "EUR" .amount }}`, "1.234,50\u00a0€"},
+		{"fr-FR", `{{ currency "EUR" .amount }}`, "1\u00a0234,50\u00a0€"},
+		{"en-US", `{{ currency "JPY" .amount }}`, "¥1,235"},
+		{"en-US", `{{ currency "EUR" 1.005 }}`, "€1.01"},
+		{"en-US", `{{ number 2 -2.675 }}`, "-2.68"},
+		{"en-US", `{{ .price }}`, "1234.50"},
+		{"en-US", `{{ number .price }}`, "1,234.50"},
+		{"de-DE", `{{ number 1 .price }}`, "1.234,5"},
+		{"en-US", `{{ number 3 .small }}`, "-0.001"},
+		{"sv-SE", `{{ number 3 .small }}`, "\u22120,001"},
+		{"de-DE", `{{ currency "EUR" .big }}`, "12.345.678.901.234.567,89\u00a0€"},
+		{"en-US", `{{ currency "JPY" .price }}`, "¥1,235"},
+		{"en-US", `{{ date .date }}`, "3/5/24"},
+		{"en-US", `{{ date "long" .date }}`, "March 5, 2024"},
+		{"en-GB", `{{ date "medium" .date }}`, "5 Mar 2024"},
+		{"de-DE", `{{ date "long" .date }}`, "5. März 2024"},
+		{"fr-FR", `{{ date "Jan 2006" .date }}`, "mars 2024"},
+		{"de-DE", `{{ date "Monday, 2. January 2006" .date }}`, "Dienstag, 5. März 2024"},
+		{"fr-FR", `{{ date "Mon 2 Jan" .date }}`, "mar. 5 mars"},
+		{"pl-PL", `{{ date "Monday" .date }}`, "Tuesday"},
+		{"en-US", `{{ date "2006-01-02" .unix }}`, "2023-11-14"},
+		{"en-US", `{{ time now }}`, "3:30 PM"},
+		{"de-DE", `{{ datetime now }}`, "05.03.24, 15:30"},
+		{"de-DE", `{{ time (inZone "America/New_York" now) }}`, "09:30"},
+		{"de-DE", `{{ time "2024-03-05T14:30:00Z" }}`, "15:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale+" "+tt.content, func(t *testing.T) {
+			r := require.New(t)
+
+			docs := []template.Template{{Name: "doc", Content: tt.content}}
+			renderer := template.NewRenderer(docs, nil, template.WithFormat(template.Format{
+				Locale:   tt.locale,
+				Location: berlin,
+				Now:      now,
+			}))
+			result, err := renderer.Render("doc", map[string]any{
+				"amount": 1234.5,
+				"rate":   0.256,
+				"date":   "2024-03-05",
+				"unix":   1700000000,
+				"price":  decimal(t, "1234.50"),
+				"small":  decimal(t, "-0.0005"),
+				"big":    decimal(t, "12345678901234567.885"),
+			})
+			r.NoError(err)
+			r.Equal(tt.expected, result)
+		})
+	}
+
+	t.Run("document variables", func(t *testing.T) {
+		r := require.New(t)
+
+		docs := []template.Template{{Name: "doc", Content: `{{ datetime "long" now }}`}}
+		renderer := template.NewRenderer(docs, nil, template.WithFormat(template.Format{Locale: "en-US", Now: now}))
+		result, err := renderer.Render("doc", map[string]any{"locale": "de-DE", "timezone": "Asia/Tokyo"})
+		r.NoError(err)
+		r.Equal("5. März 2024, 23:30", result)
+
+		_, err = renderer.Render("doc", map[string]any{"timezone": "Mars/Olympus"})
+		r.ErrorIs(err, template.ErrInvalidValue)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		r := require.New(t)
+
+		funcs := template.FormatFuncs(template.Format{})
+		currency := funcs["currency"].(func(string, any) (string, error))
+		_, err := currency("EURO", 1)
+		r.ErrorIs(err, template.ErrInvalidValue)
+		_, err = currency("EUR", "ten")
+		r.ErrorIs(err, template.ErrInvalidValue)
+
+		date := funcs["date"].(func(...any) (string, error))
+		_, err = date("yesterday")
+		r.ErrorIs(err, template.ErrInvalidValue)
+	})
+}
+
+func decimal(t *testing.T, s string) config.Decimal {
+	t.Helper()
+	d, err := config.ParseDecimal(s)
+	require.NoError(t, err)
+	return d
+}
@@ -0,0 +1,69 @@
+package template
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"github.com/friendsofgo/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+const frontMatterDelimiter = "---"
+
+// FrontMatter holds the settings of the YAML block at the start of a template,
+// enclosed by "---" lines.
+type FrontMatter struct {
+	// MJML overrides the MJML options of the document
+	MJML config.MJMLOverride `yaml:"mjml"`
+	// Params declares the parameters of a partial, calls of the partial are
+	// validated against them
+	Params []Param `yaml:"params"`
+	// Head set to false leaves out the head fragments of the config
+	Head *bool `yaml:"head"`
+}
+
+var ErrInvalidFrontMatter = errors.New("invalid front matter")
+
+// ParseFrontMatter splits the front matter from the content of a template. The
+// front matter is replaced by a template comment spanning the same lines, so
+// that line numbers in template errors stay correct.
+func ParseFrontMatter(content string) (FrontMatter, string, error) {
+	var frontMatter FrontMatter
+
+	lines := strings.SplitAfter(content, "\n")
+	if !isFrontMatterDelimiter(lines[0]) {
+		return frontMatter, content, nil
+	}
+
+	end := slices.IndexFunc(lines[1:], isFrontMatterDelimiter) + 1
+	if end == 0 {
+		return frontMatter, "", errors.Wrap(ErrInvalidFrontMatter, "missing closing ---")
+	}
+
+	if block := strings.Join(lines[1:end], ""); strings.TrimSpace(block) != "" {
+		decoder := yaml.NewDecoder(bytes.NewBufferString(block))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&frontMatter); err != nil {
+			return frontMatter, "", errors.Wrapf(ErrInvalidFrontMatter, "%v", err)
+		}
+	}
+
+	if level := frontMatter.MJML.ValidationLevel; level != "" && !slices.Contains(config.ValidationLevels, level) {
+		return frontMatter, "", errors.Wrapf(ErrInvalidFrontMatter, "mjml.validationLevel: invalid value %q, expected one of %s",
+			level, strings.Join(config.ValidationLevels, ", "))
+	}
+
+	if err := validateParams(frontMatter.Params); err != nil {
+		return frontMatter, "", err
+	}
+
+	newlines := strings.Count(strings.Join(lines[:end+1], ""), "\n")
+	return frontMatter, "{{/*" + strings.Repeat("\n", newlines) + "*/}}" + strings.Join(lines[end+1:], ""), nil
+}
+
+func isFrontMatterDelimiter(line string) bool {
+	return strings.TrimRight(line, " \t\r\n") == frontMatterDelimiter
+}
@@ -0,0 +1,64 @@
+package template
+
+import "strings"
+
+// headTemplate is the name of the template holding the head fragments, it is
+// rendered with the data of the document.
+const headTemplate = "_envelopr_head"
+
+// headSource identifies the head fragments in messages.
+const headSource = "mjml.head"
+
+// WithHead sets the MJML added to the mj-head of every MJML document, unless
+// the front matter of the document sets head to false. The head is a template
+// that may call the partials of the document.
+func WithHead(head string) RendererOption {
+	return func(r *Renderer) {
+		r.head = head
+	}
+}
+
+// usesHead reports whether the head fragments are added to the document.
+func (t Template) usesHead() bool {
+	return !t.HTML && (t.FrontMatter.Head == nil || *t.FrontMatter.Head)
+}
+
+// injectHead adds head at the start of the mj-head of an MJML document, so that
+// the head elements of the document take precedence. An mj-head is created if
+// the document has none.
+func injectHead(content, head string) string {
+	if head == "" {
+		return content
+	}
+
+	if start, end, ok := findTag(content, "mj-head"); ok {
+		if strings.HasSuffix(content[start:end], "/>") {
+			return content[:start] + "<mj-head>" + head + "</mj-head>" + content[end:]
+		}
+		return content[:end] + head + content[end:]
+	}
+	if _, end, ok := findTag(content, "mjml"); ok {
+		return content[:end] + "<mj-head>" + head + "</mj-head>" + content[end:]
+	}
+	return content
+}
+
+// findTag returns the position of the first start tag with the given name.
+func findTag(content, name string) (int, int, bool) {
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], "<"+name)
+		if i < 0 {
+			return 0, 0, false
+		}
+		start := offset + i
+		rest := content[start+len(name)+1:]
+		if rest != "" && strings.ContainsRune(" \t\r\n/>", rune(rest[0])) {
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return 0, 0, false
+			}
+			return start, start + len(name) + 1 + end + 1, true
+		}
+		offset = start + 1
+	}
+}
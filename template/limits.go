@@ -0,0 +1,376 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/friendsofgo/errors"
+	sproutstrings "github.com/go-sprout/sprout/registry/strings"
+)
+
+var ErrLimitExceeded = errors.New("limit exceeded")
+var ErrRestricted = errors.New("not available in restricted mode")
+
+// Limits restrict the resources used to render a document, zero values disable
+// a limit. With any limit set or in restricted mode, the functions building
+// large values from small arguments, like repeat, fail before allocating a
+// value larger than MaxOutputSize or, without it, defaultMaxValueSize.
+type Limits struct {
+	// Timeout is the maximum duration of rendering a document
+	Timeout time.Duration
+	// MaxOutputSize is the maximum size of a rendered document in bytes
+	MaxOutputSize int
+	// MaxDepth is the maximum nesting depth of template calls
+	MaxDepth int
+}
+
+// WithLimits sets the limits of rendering a document.
+func WithLimits(limits Limits) RendererOption {
+	return func(r *Renderer) {
+		r.limits = limits
+	}
+}
+
+// WithRestricted limits templates to the functions of AllowedRestrictedFuncs
+// and the functions of envelopr, so that they have no access to the
+// environment, files or code outside of the template.
+func WithRestricted() RendererOption {
+	return func(r *Renderer) {
+		r.restricted = true
+	}
+}
+
+// AllowedRestrictedFuncs are the builtin and sprout functions available in
+// restricted mode, all others fail with ErrRestricted. The functions of
+// envelopr are available, but the barcode functions cannot write files.
+//
+//nolint:gochecknoglobals
+var AllowedRestrictedFuncs = []string{
+	// text/template, without call running functions found in the data
+	"and", "eq", "ge", "gt", "html", "index", "js", "le", "len", "lt", "ne", "not", "or",
+	"print", "printf", "println", "slice", "urlquery",
+	// sprout strings
+	"capitalize", "contains", "ellipsis", "ellipsisBoth", "hasPrefix", "hasSuffix", "indent",
+	"initials", "join", "nindent", "nospace", "plural", "quote", "repeat", "replace", "seq",
+	"shuffle", "split", "splitn", "squote", "substr", "swapCase", "toCamelCase",
+	"toConstantCase", "toDotCase", "toKebabCase", "toLower", "toPascalCase", "toPathCase",
+	"toSnakeCase", "toTitleCase", "toUpper", "trim", "trimAll", "trimPrefix", "trimSuffix",
+	"trunc", "uncapitalize", "untitle", "wrap", "wrapWith",
+	// sprout numeric
+	"add", "add1", "add1f", "addf", "ceil", "div", "divf", "floor", "max", "maxf", "min",
+	"minf", "mod", "mul", "mulf", "round", "sub", "subf",
+	// sprout maps
+	"dict", "dig", "get", "hasKey", "keys", "merge", "mergeOverwrite", "mustMerge",
+	"mustMergeOverwrite", "omit", "pick", "pluck", "set", "unset", "values",
+}
+
+// builtinFuncs are the functions predefined by text/template.
+//
+//nolint:gochecknoglobals
+var builtinFuncs = []string{
+	"and", "call", "eq", "ge", "gt", "html", "index", "js", "le", "len", "lt", "ne", "not", "or",
+	"print", "printf", "println", "slice", "urlquery",
+}
+
+// restrict replaces the builtin functions and the functions of funcs missing
+// from AllowedRestrictedFuncs with functions failing with ErrRestricted.
+func restrict(funcs template.FuncMap) template.FuncMap {
+	allowed := make(map[string]bool, len(AllowedRestrictedFuncs))
+	for _, name := range AllowedRestrictedFuncs {
+		allowed[name] = true
+	}
+
+	restricted := make(template.FuncMap, len(funcs)+len(builtinFuncs))
+	for _, name := range builtinFuncs {
+		if !allowed[name] {
+			restricted[name] = deny(name)
+		}
+	}
+	for name, fn := range funcs {
+		if allowed[name] {
+			restricted[name] = fn
+		} else {
+			restricted[name] = deny(name)
+		}
+	}
+	return restricted
+}
+
+// deny returns a function failing with ErrRestricted in place of the function
+// with the name.
+func deny(name string) func(...any) (string, error) {
+	return func(...any) (string, error) {
+		return "", errors.Wrapf(ErrRestricted, "function %s", name)
+	}
+}
+
+// defaultMaxValueSize is the maximum size in bytes of a value built by a
+// function when limits are set without a maximum output size.
+const defaultMaxValueSize = 16 << 20
+
+// Functions used to track the nesting depth of template calls and to stop
+// loops after the timeout.
+const (
+	enterFunc = "_envelopr_enter"
+	leaveFunc = "_envelopr_leave"
+	checkFunc = "_envelopr_check"
+)
+
+// execution is the state of rendering a single document.
+type execution struct {
+	ctx    context.Context
+	limits Limits
+	depth  int
+	// tracked is set once the templates call the tracking functions
+	tracked bool
+}
+
+// check reports an exceeded timeout.
+func (e *execution) check() error {
+	if err := e.ctx.Err(); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return errors.Wrapf(ErrLimitExceeded, "rendering took longer than %s", e.limits.Timeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// funcs returns the functions enforcing the limits of the execution.
+func (e *execution) funcs(restricted bool) template.FuncMap {
+	funcs := template.FuncMap{
+		enterFunc: func() (HTML, error) {
+			e.depth++
+			if e.limits.MaxDepth > 0 && e.depth > e.limits.MaxDepth {
+				return "", errors.Wrapf(ErrLimitExceeded, "templates are nested deeper than %d levels", e.limits.MaxDepth)
+			}
+			return "", e.check()
+		},
+		leaveFunc: func() HTML {
+			e.depth--
+			return ""
+		},
+		checkFunc: func() (HTML, error) {
+			return "", e.check()
+		},
+	}
+
+	if size := e.maxValueSize(restricted); size > 0 {
+		for name, fn := range sizeFuncs(size) {
+			funcs[name] = fn
+		}
+	}
+
+	return funcs
+}
+
+// maxValueSize returns the maximum size of a value built by a function, zero
+// without limits.
+func (e *execution) maxValueSize(restricted bool) int {
+	switch {
+	case e.limits.MaxOutputSize > 0:
+		return e.limits.MaxOutputSize
+	case restricted || e.limits != Limits{}:
+		return defaultMaxValueSize
+	default:
+		return 0
+	}
+}
+
+// sizeFuncs returns the sprout functions whose result can be much larger than
+// their arguments, failing before they build a value larger than size bytes.
+func sizeFuncs(size int) template.FuncMap {
+	sprout := sproutstrings.NewRegistry()
+	exceeded := func() error {
+		return errors.Wrapf(ErrLimitExceeded, "value is larger than %d bytes", size)
+	}
+	// larger reports whether n bytes repeated count times and extra bytes
+	// exceed size.
+	larger := func(count, n, extra int) bool {
+		return extra > size || (count > 0 && n > (size-extra)/count)
+	}
+
+	indent := func(spaces int, str string) (string, error) {
+		if larger(strings.Count(str, "\n")+1, spaces+1, len(str)) {
+			return "", exceeded()
+		}
+		return sprout.Indent(spaces, str), nil
+	}
+	return template.FuncMap{
+		"repeat": func(count int, str string) (string, error) {
+			if larger(count, len(str), 0) {
+				return "", exceeded()
+			}
+			return sprout.Repeat(count, str), nil
+		},
+		"indent": indent,
+		"nindent": func(spaces int, str string) (string, error) {
+			indented, err := indent(spaces, str)
+			return "\n" + indented, err
+		},
+		"replace": func(old, replacement, src string) (string, error) {
+			if larger(strings.Count(src, old), len(replacement), len(src)) {
+				return "", exceeded()
+			}
+			return sprout.Replace(old, replacement, src), nil
+		},
+		"wrapWith": func(length int, newLine, str string) (string, error) {
+			if larger(len(str), len(newLine), len(str)) {
+				return "", exceeded()
+			}
+			return sprout.WrapWith(length, newLine, str), nil
+		},
+		"seq": func(params ...int) (string, error) {
+			// seq builds a slice of the numbers before joining them
+			if larger(seqLength(params), 8, 0) {
+				return "", exceeded()
+			}
+			return sprout.Seq(params...), nil
+		},
+	}
+}
+
+// seqLength returns the number of values seq returns for the params, capped
+// to the maximum int.
+func seqLength(params []int) int {
+	var start, step, end int
+	switch len(params) {
+	case 1:
+		start, step, end = 1, 1, params[0]
+	case 2:
+		start, step, end = params[0], 1, params[1]
+	case 3:
+		start, step, end = params[0], params[1], params[2]
+	default:
+		return 0
+	}
+	if end < start {
+		start, end, step = end, start, -step
+		if len(params) < 3 {
+			step = 1
+		}
+	}
+	if step <= 0 {
+		return 0
+	}
+	// The difference does not fit into an int for the extremes
+	span := uint64(end) - uint64(start)
+	length := span/uint64(step) + 1
+	if length > math.MaxInt {
+		return math.MaxInt
+	}
+	return int(length)
+}
+
+// execute runs the template with the limits of the execution. When the timeout
+// is exceeded, the template stops at its next output, template call or range
+// iteration, and a function running at the timeout completes in the
+// background. With limits, the functions building large values are capped by
+// the maximum value size, so that the work left in the background is bounded.
+// The templates of the set are prepared on the first call.
+func (e *execution) execute(tmpl *template.Template, data any) (string, error) {
+	if !e.tracked && (e.limits.MaxDepth > 0 || e.ctx.Done() != nil) {
+		trackDepth(tmpl)
+		e.tracked = true
+	}
+
+	var buf bytes.Buffer
+	w := &limitedWriter{execution: e, buf: &buf}
+	if e.ctx.Done() == nil {
+		err := tmpl.Execute(w, data)
+		return buf.String(), err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- tmpl.Execute(w, data)
+	}()
+	select {
+	case err := <-done:
+		return buf.String(), err
+	case <-e.ctx.Done():
+		return "", e.check()
+	}
+}
+
+// limitedWriter fails writes beyond the maximum output size or after the
+// timeout, which aborts the execution of the template.
+type limitedWriter struct {
+	execution *execution
+	buf       *bytes.Buffer
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if err := w.execution.check(); err != nil {
+		return 0, err
+	}
+	if limit := w.execution.limits.MaxOutputSize; limit > 0 && w.buf.Len()+len(p) > limit {
+		return 0, errors.Wrapf(ErrLimitExceeded, "output is larger than %d bytes", limit)
+	}
+	return w.buf.Write(p)
+}
+
+// trackDepth wraps the body of every template of the set in calls of the enter
+// and leave functions, and starts the body of every range with a call of the
+// check function, so that loops without output stop after the timeout.
+func trackDepth(tmpl *template.Template) {
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		checkRanges(t.Tree, t.Tree.Root)
+
+		root := t.Tree.Root
+		nodes := make([]parse.Node, 0, len(root.Nodes)+2)
+		nodes = append(nodes, callAction(t.Tree, root.Pos, enterFunc))
+		nodes = append(nodes, root.Nodes...)
+		nodes = append(nodes, callAction(t.Tree, root.Pos, leaveFunc))
+		root.Nodes = nodes
+	}
+}
+
+// checkRanges adds a call of the check function to the start of the range
+// bodies in list.
+func checkRanges(tree *parse.Tree, list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.IfNode:
+			checkRanges(tree, n.List)
+			checkRanges(tree, n.ElseList)
+		case *parse.WithNode:
+			checkRanges(tree, n.List)
+			checkRanges(tree, n.ElseList)
+		case *parse.RangeNode:
+			checkRanges(tree, n.List)
+			checkRanges(tree, n.ElseList)
+			n.List.Nodes = append([]parse.Node{callAction(tree, n.Position(), checkFunc)}, n.List.Nodes...)
+		case *parse.ListNode:
+			checkRanges(tree, n)
+		}
+	}
+}
+
+// callAction returns an action calling the function without arguments.
+func callAction(tree *parse.Tree, pos parse.Pos, fn string) *parse.ActionNode {
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      pos,
+				Args:     []parse.Node{parse.NewIdentifier(fn).SetTree(tree).SetPos(pos)},
+			}},
+		},
+	}
+}
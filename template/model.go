@@ -2,5 +2,25 @@ package template
 
 type Template struct {
 	Name    string
+	Path    string
 	Content string
+	// FrontMatter holds the settings from the start of the file, Content does not
+	// include it
+	FrontMatter FrontMatter
+	// HTML documents are plain HTML, they are rendered but not compiled by MJML
+	HTML bool
+	// Local partials are only visible to the documents in Scope, the directory
+	// relative to the documents directory, and its subdirectories. They shadow
+	// global partials of the same name.
+	Local bool
+	Scope string
+}
+
+// source identifies the file of a template in messages, templates created
+// without a file use their name.
+func (t Template) source() string {
+	if t.Path == "" {
+		return t.Name
+	}
+	return t.Path
 }
@@ -0,0 +1,203 @@
+package template
+
+import (
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/friendsofgo/errors"
+)
+
+// endingTags are the MJML components whose content is not parsed as MJML, so
+// comments in them are kept unchanged.
+//
+//nolint:gochecknoglobals
+var endingTags = []string{
+	"mj-raw", "mj-text", "mj-button", "mj-table", "mj-style", "mj-title", "mj-preview",
+	"mj-navbar-link", "mj-accordion-title", "mj-accordion-text", "mj-social-element",
+}
+
+// protectConditionalComments wraps conditional comments between MJML components
+// in mj-raw. MJML removes comments between components, or breaks conditional
+// comments when it keeps them, but leaves the content of mj-raw unchanged.
+func protectConditionalComments(content string) string {
+	var b strings.Builder
+	depth := 0
+	for {
+		i := strings.IndexByte(content, '<')
+		if i < 0 {
+			break
+		}
+		b.WriteString(content[:i])
+		content = content[i:]
+
+		switch {
+		case strings.HasPrefix(content, "<!--"):
+			end := strings.Index(content[len("<!--"):], "-->")
+			if end < 0 {
+				b.WriteString(content)
+				return b.String()
+			}
+			end += len("<!--") + len("-->")
+			comment := content[:end]
+			if depth == 0 && isConditionalComment(comment) {
+				if strings.HasPrefix(comment, "<!--<![endif]") {
+					comment = revealedEnd
+				}
+				comment = "<mj-raw>" + comment + "</mj-raw>"
+			}
+			b.WriteString(comment)
+			content = content[end:]
+			continue
+		case strings.HasPrefix(content, "</"):
+			if isEndingTag(content[len("</"):]) && depth > 0 {
+				depth--
+			}
+		default:
+			if isEndingTag(content[1:]) {
+				end := strings.IndexByte(content, '>')
+				if end > 0 && content[end-1] != '/' {
+					depth++
+				}
+			}
+		}
+		b.WriteByte('<')
+		content = content[1:]
+	}
+	b.WriteString(content)
+	return b.String()
+}
+
+// revealedEnd ends a conditional comment showing its content to clients
+// other than Outlook. The empty comment keeps MJML from merging it with a
+// following conditional comment of its own, which would break both.
+const revealedEnd = "<!--<![endif]--><!---->"
+
+// isConditionalComment reports whether a comment is an Outlook conditional
+// comment, or the start or end of one that shows its content to other clients.
+func isConditionalComment(comment string) bool {
+	return strings.HasPrefix(comment, "<!--[if ") || strings.HasPrefix(comment, "<!--<![endif]")
+}
+
+// isEndingTag reports whether s starts with the name of an ending tag.
+func isEndingTag(s string) bool {
+	for _, tag := range endingTags {
+		if rest, ok := strings.CutPrefix(s, tag); ok && rest != "" && strings.ContainsRune(" \t\r\n/>", rune(rest[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+// msoFuncs returns the functions creating Outlook specific markup. They return
+// mj-raw blocks, which are placed between MJML components:
+//
+//	{{ mso "<table><tr><td>" }}           HTML for Outlook only
+//	{{ mso "gte mso 12" "..." }}          with a condition
+//	{{ notMsoStart }}...{{ notMsoEnd }}   MJML hidden from Outlook
+//	{{ ghostTableStart 600 }}...{{ ghostColumn 300 }}...{{ ghostTableEnd }}
+//	{{ vmlButton (dict "href" .url "text" "Shop now" "background" "#2563eb") }}
+func msoFuncs() template.FuncMap {
+	raw := func(s string) HTML {
+		return HTML("<mj-raw>" + s + "</mj-raw>")
+	}
+	conditional := func(condition, s string) HTML {
+		return raw("<!--[if " + condition + "]>" + s + "<![endif]-->")
+	}
+
+	return template.FuncMap{
+		"mso": func(args ...any) (HTML, error) {
+			switch len(args) {
+			case 1:
+				return conditional("mso", toString(args[0])), nil
+			case 2:
+				return conditional(toString(args[0]), toString(args[1])), nil
+			}
+			return "", errors.Wrapf(ErrInvalidValue, "expected HTML and an optional condition, got %d arguments", len(args))
+		},
+		"notMsoStart": func() HTML {
+			return raw("<!--[if !mso]><!-->")
+		},
+		"notMsoEnd": func() HTML {
+			return raw(revealedEnd)
+		},
+		"ghostTableStart": func(width int) HTML {
+			return conditional("mso", fmt.Sprintf(
+				`<table role="presentation" border="0" cellpadding="0" cellspacing="0" width="%d" align="center"><tr><td width="%d" valign="top">`,
+				width, width))
+		},
+		"ghostColumn": func(width int) HTML {
+			return conditional("mso", fmt.Sprintf(`</td><td width="%d" valign="top">`, width))
+		},
+		"ghostTableEnd": func() HTML {
+			return conditional("mso", "</td></tr></table>")
+		},
+		"vmlButton": vmlButton,
+	}
+}
+
+// toString returns the string of a function argument, HTML is not escaped.
+func toString(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// vmlButton returns a button drawn with VML in Outlook and with a styled link in
+// other clients. Outlook does not support padding and border radius on links.
+func vmlButton(options map[string]any) (HTML, error) {
+	button := struct {
+		href, text, color, background, font string
+		width, height, radius, fontSize     int
+	}{
+		color: "#ffffff", background: "#2563eb", font: "Arial, sans-serif",
+		width: 200, height: 40, radius: 6, fontSize: 16,
+	}
+
+	texts := map[string]*string{
+		"href": &button.href, "text": &button.text, "color": &button.color, "background": &button.background, "font": &button.font,
+	}
+	sizes := map[string]*int{
+		"width": &button.width, "height": &button.height, "radius": &button.radius, "fontSize": &button.fontSize,
+	}
+	for key, value := range options {
+		if text, ok := texts[key]; ok {
+			*text = toString(value)
+			continue
+		}
+		size, ok := sizes[key]
+		if !ok {
+			return "", errors.Wrapf(ErrInvalidValue, "unknown vmlButton option %q", key)
+		}
+		v := reflect.ValueOf(value)
+		if !v.CanInt() || v.Int() < 0 {
+			return "", errors.Wrapf(ErrInvalidValue, "vmlButton %s: expected a number of pixels, got %v", key, value)
+		}
+		*size = int(v.Int())
+	}
+	button.href = filterURL(button.href)
+	if button.href == "" || button.text == "" {
+		return "", errors.Wrap(ErrInvalidValue, "vmlButton needs href and text")
+	}
+
+	// VML expresses the radius as percentage of the shorter side
+	arcsize := 0
+	if side := min(button.width, button.height); side > 0 {
+		arcsize = min(100*button.radius/side, 50)
+	}
+
+	e := html.EscapeString
+	font := fmt.Sprintf("color:%s;font-family:%s;font-size:%dpx;font-weight:bold;", e(button.color), e(button.font), button.fontSize)
+	return HTML(fmt.Sprintf(`<mj-raw><!--[if mso]>`+
+		`<v:roundrect xmlns:v="urn:schemas-microsoft-com:vml" xmlns:w="urn:schemas-microsoft-com:office:word" href="%s" `+
+		`style="height:%dpx;v-text-anchor:middle;width:%dpx;" arcsize="%d%%" stroke="f" fillcolor="%s">`+
+		`<w:anchorlock/><center style="%s">%s</center></v:roundrect><![endif]-->`+
+		`<!--[if !mso]><!--><a href="%s" style="background-color:%s;border-radius:%dpx;display:inline-block;%s`+
+		`line-height:%dpx;text-align:center;text-decoration:none;width:%dpx;-webkit-text-size-adjust:none;">%s</a>`+revealedEnd+`</mj-raw>`,
+		e(button.href), button.height, button.width, arcsize, e(button.background), font, e(button.text),
+		e(button.href), e(button.background), button.radius, font, button.height, button.width, e(button.text),
+	)), nil
+}
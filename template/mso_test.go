@@ -0,0 +1,85 @@
+package template_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/config"
+	"github.com/esdete2/envelopr/template"
+)
+
+func TestMsoFuncs(t *testing.T) {
+	compile := func(t *testing.T, body string, keepComments bool) (string, error) {
+		t.Helper()
+		docs := []template.Template{{Name: "doc", Content: `<mjml><mj-body>` + body + `</mj-body></mjml>`}}
+		rendered, err := template.NewRenderer(docs, nil).Render("doc", map[string]any{"url": "https://example.com/shop"})
+		if err != nil {
+			return "", err
+		}
+		compiler := template.NewCompiler(&config.Config{})
+		return compiler.CompileWithOptions(rendered, config.MJMLConfig{
+			Minify:          true,
+			ValidationLevel: "soft",
+			KeepComments:    keepComments,
+		})
+	}
+
+	t.Run("conditional comments between components", func(t *testing.T) {
+		r := require.New(t)
+
+		for _, keepComments := range []bool{false, true} {
+			result, err := compile(t, `<!--[if mso]><table><tr><td><![endif]-->`+
+				`<mj-section><mj-column><mj-text>Hello</mj-text></mj-column></mj-section>`+
+				`<!--[if mso]></td></tr></table><![endif]-->`, keepComments)
+			r.NoError(err)
+			r.Contains(result, `<!--[if mso]><table><tr><td>`) // merged with the conditional comment of the section
+			r.Contains(result, `<!--[if mso]></td></tr></table><![endif]-->`)
+			r.NotContains(result, `<!-- [if mso]>`)
+		}
+	})
+
+	t.Run("helpers", func(t *testing.T) {
+		r := require.New(t)
+
+		result, err := compile(t, `{{ ghostTableStart 600 }}`+
+			`<mj-section>{{ notMsoStart }}<mj-column><mj-text>Web</mj-text></mj-column>{{ notMsoEnd }}</mj-section>`+
+			`{{ ghostColumn 300 }}{{ mso "gte mso 12" "<p>Outlook</p>" }}{{ ghostTableEnd }}`, false)
+		r.NoError(err)
+		r.Contains(result, `<!--[if mso]><table role="presentation" border="0" cellpadding="0" cellspacing="0" width="600" align="center"><tr><td width="600" valign="top">`)
+		r.Contains(result, `<!--[if mso]></td><td width="300" valign="top"><![endif]-->`)
+		r.Contains(result, `<!--[if gte mso 12]><p>Outlook</p><![endif]-->`)
+		r.Contains(result, `<!--[if !mso]><!-->`)
+		r.Contains(result, `<!--<![endif]--><!---->`) // not merged with the conditional comments of MJML
+	})
+
+	t.Run("vml button", func(t *testing.T) {
+		r := require.New(t)
+
+		result, err := compile(t, `<mj-section><mj-column>`+
+			`{{ vmlButton (dict "href" .url "text" "Shop & save" "width" 240 "height" 48 "radius" 8) }}`+
+			`</mj-column></mj-section>`, false)
+		r.NoError(err)
+		r.Contains(result, `href="https://example.com/shop" style="height:48px;v-text-anchor:middle;width:240px;" arcsize="16%"`)
+		r.Contains(result, `>Shop &amp; save</center></v:roundrect><![endif]-->`)
+		r.Contains(result, `<!--[if !mso]><!--><a href="https://example.com/shop"`)
+
+		result, err = compile(t, `{{ vmlButton (dict "href" "javascript:alert(1)" "text" "Shop") }}`, false)
+		r.NoError(err)
+		r.Contains(result, `href="#ZgotmplZ"`)
+		r.NotContains(result, "javascript")
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := compile(t, `{{ vmlButton (dict "text" "Shop") }}`, false)
+		r.ErrorContains(err, "vmlButton needs href and text")
+
+		_, err = compile(t, `{{ vmlButton (dict "href" .url "text" "Shop" "colour" "#fff") }}`, false)
+		r.ErrorContains(err, `unknown vmlButton option "colour"`)
+
+		_, err = compile(t, `{{ mso }}`, false)
+		r.ErrorIs(err, template.ErrInvalidValue)
+	})
+}
@@ -0,0 +1,230 @@
+package template
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/friendsofgo/errors"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+var ErrInvalidParams = errors.New("invalid partial parameters")
+
+// Param is a parameter of a partial, declared in the params list of its front
+// matter.
+type Param struct {
+	Name string `yaml:"name"`
+	// Type of the value, one of ParamTypes, any value is accepted if empty
+	Type        string `yaml:"type"`
+	Required    bool   `yaml:"required"`
+	Default     any    `yaml:"default"`
+	Description string `yaml:"description"`
+}
+
+// Types of partial parameters.
+const (
+	ParamString = "string"
+	ParamNumber = "number"
+	ParamBool   = "bool"
+	ParamList   = "list"
+	ParamMap    = "map"
+	ParamAny    = "any"
+)
+
+var ParamTypes = []string{ParamString, ParamNumber, ParamBool, ParamList, ParamMap, ParamAny} //nolint:gochecknoglobals
+
+// paramsFunc validates the data passed to a partial with parameters, calls of
+// these partials are rewritten to pass their data through it.
+const paramsFunc = "_envelopr_params"
+
+// validateParams checks the parameter declarations of a front matter.
+func validateParams(params []Param) error {
+	seen := make(map[string]bool, len(params))
+	for i, p := range params {
+		switch {
+		case p.Name == "":
+			return errors.Wrapf(ErrInvalidFrontMatter, "params[%d]: missing name", i)
+		case seen[p.Name]:
+			return errors.Wrapf(ErrInvalidFrontMatter, "params[%d]: duplicate parameter %q", i, p.Name)
+		case p.Type != "" && !slices.Contains(ParamTypes, p.Type):
+			return errors.Wrapf(ErrInvalidFrontMatter, "params[%d].type: invalid value %q, expected one of %s",
+				i, p.Type, strings.Join(ParamTypes, ", "))
+		case p.Required && p.Default != nil:
+			return errors.Wrapf(ErrInvalidFrontMatter, "params[%d]: required parameter %q cannot have a default", i, p.Name)
+		case p.Default != nil && !hasParamType(p.Default, p.Type):
+			return errors.Wrapf(ErrInvalidFrontMatter, "params[%d].default: expected a %s, got %v", i, p.Type, p.Default)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+// hasParamType reports whether value is of the parameter type.
+func hasParamType(value any, typ string) bool {
+	if _, ok := value.(config.Decimal); ok {
+		return typ == ParamNumber || typ == ParamAny || typ == ""
+	}
+
+	v := reflect.ValueOf(value)
+	switch typ {
+	case ParamString:
+		return v.Kind() == reflect.String
+	case ParamNumber:
+		switch v.Kind() { //nolint:exhaustive
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	case ParamBool:
+		return v.Kind() == reflect.Bool
+	case ParamList:
+		return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+	case ParamMap:
+		return v.Kind() == reflect.Map
+	}
+	return true
+}
+
+// contracts holds the parameters of the partials of a template set by name.
+type contracts map[string][]Param
+
+// funcs returns the function validating the data passed to a partial. It
+// returns a copy of the data with the defaults of missing parameters.
+func (c contracts) funcs() template.FuncMap {
+	return template.FuncMap{
+		paramsFunc: func(name, caller string, data any) (map[string]any, error) {
+			var values map[string]any
+			switch data := data.(type) {
+			case nil:
+			case map[string]any:
+				values = data
+			default:
+				return nil, errors.Wrapf(ErrInvalidParams, "partial %q called from %s: expected a dict, got %T", name, caller, data)
+			}
+
+			result := make(map[string]any, len(values)+len(c[name]))
+			for k, v := range values {
+				result[k] = v
+			}
+
+			var missing []string
+			for _, p := range c[name] {
+				value, ok := result[p.Name]
+				switch {
+				case (!ok || value == nil) && p.Required:
+					missing = append(missing, p.Name)
+				case !ok || value == nil:
+					if p.Default != nil {
+						result[p.Name] = p.Default
+					}
+				case !hasParamType(value, p.Type):
+					return nil, errors.Wrapf(ErrInvalidParams, "partial %q called from %s: parameter %q expects a %s, got %v",
+						name, caller, p.Name, p.Type, value)
+				}
+			}
+			if len(missing) > 0 {
+				return nil, errors.Wrapf(ErrInvalidParams, "partial %q called from %s: missing required parameter %s",
+					name, caller, strings.Join(quoteAll(missing), ", "))
+			}
+			return result, nil
+		},
+	}
+}
+
+func quoteAll(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return quoted
+}
+
+// checkCalls passes the data of all calls of partials with parameters through
+// the validation function. Callers are identified by the file they were parsed
+// from and the line of the call.
+func (c contracts) checkCalls(tmpl *template.Template, sources *templateSources) {
+	if len(c) == 0 {
+		return
+	}
+
+	// Templates sharing a tree are only rewritten once
+	done := make(map[*parse.Tree]bool)
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || done[t.Tree] {
+			continue
+		}
+		done[t.Tree] = true
+		c.checkList(t.Tree, t.Tree.Root, sources.paths[t.Tree.ParseName])
+	}
+}
+
+func (c contracts) checkList(tree *parse.Tree, list *parse.ListNode, path string) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.TemplateNode:
+			if _, ok := c[node.Name]; ok {
+				node.Pipe = c.validatingPipe(tree, node, path)
+			}
+		case *parse.IfNode:
+			c.checkList(tree, node.List, path)
+			c.checkList(tree, node.ElseList, path)
+		case *parse.RangeNode:
+			c.checkList(tree, node.List, path)
+			c.checkList(tree, node.ElseList, path)
+		case *parse.WithNode:
+			c.checkList(tree, node.List, path)
+			c.checkList(tree, node.ElseList, path)
+		case *parse.ListNode:
+			c.checkList(tree, node, path)
+		}
+	}
+}
+
+// validatingPipe returns the pipeline of a template call that passes its data
+// through the validation function.
+func (c contracts) validatingPipe(tree *parse.Tree, node *parse.TemplateNode, path string) *parse.PipeNode {
+	location, _ := tree.ErrorContext(node)
+	caller := strings.TrimPrefix(location, tree.ParseName)
+	if path == "" {
+		path = tree.ParseName
+	}
+	// Only the line is kept, columns count bytes and are of little help
+	if i := strings.LastIndexByte(caller, ':'); i > 0 {
+		caller = caller[:i]
+	}
+
+	var data parse.Node = &parse.NilNode{NodeType: parse.NodeNil, Pos: node.Pos}
+	if node.Pipe != nil {
+		data = node.Pipe
+	}
+
+	return &parse.PipeNode{
+		NodeType: parse.NodePipe,
+		Pos:      node.Pos,
+		Line:     node.Line,
+		Cmds: []*parse.CommandNode{{
+			NodeType: parse.NodeCommand,
+			Pos:      node.Pos,
+			Args: []parse.Node{
+				parse.NewIdentifier(paramsFunc).SetTree(tree).SetPos(node.Pos),
+				stringNode(node.Pos, node.Name),
+				stringNode(node.Pos, path+caller),
+				data,
+			},
+		}},
+	}
+}
+
+func stringNode(pos parse.Pos, s string) *parse.StringNode {
+	return &parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(s), Text: s}
+}
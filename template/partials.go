@@ -0,0 +1,139 @@
+package template
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/friendsofgo/errors"
+
+	"github.com/esdete2/envelopr/config"
+)
+
+// partialsFor returns the partials visible to a document: the global partials
+// followed by the local partials from the top-level directory down to the
+// directory of the document. A local partial replaces the global or local
+// partial of the same name further up.
+func (r *Renderer) partialsFor(name string) []Template {
+	dir := path.Dir(name)
+	if dir == "." {
+		dir = ""
+	}
+
+	visible := make([]Template, 0, len(r.partials))
+	for _, p := range r.partials {
+		if !p.Local || p.Scope == "" || p.Scope == dir || strings.HasPrefix(dir, p.Scope+"/") {
+			visible = append(visible, p)
+		}
+	}
+
+	sort.SliceStable(visible, func(i, j int) bool {
+		a, b := visible[i], visible[j]
+		if a.Local != b.Local {
+			return !a.Local
+		}
+		if depthA, depthB := scopeDepth(a.Scope), scopeDepth(b.Scope); depthA != depthB {
+			return depthA < depthB
+		}
+		return a.Name < b.Name
+	})
+
+	partials := make([]Template, 0, len(visible))
+	index := make(map[string]int)
+	for _, p := range visible {
+		if i, shadowed := index[p.Name]; shadowed {
+			partials[i] = p
+			continue
+		}
+		index[p.Name] = len(partials)
+		partials = append(partials, p)
+	}
+	return partials
+}
+
+func scopeDepth(scope string) int {
+	if scope == "" {
+		return 0
+	}
+	return strings.Count(scope, "/") + 1
+}
+
+// templateSources tracks the file every template of a set was parsed from,
+// including the templates declared with define, and the templates that
+// replaced a definition from another file.
+type templateSources struct {
+	paths      map[string]string
+	trees      map[string]*parse.Tree
+	duplicates []duplicate
+}
+
+// duplicate is a template defined in two files, the definition from path
+// replaced the one from shadowed.
+type duplicate struct {
+	name     string
+	path     string
+	shadowed string
+}
+
+func newTemplateSources(tmpl *template.Template, path string) *templateSources {
+	sources := &templateSources{
+		paths: make(map[string]string),
+		trees: make(map[string]*parse.Tree),
+	}
+	sources.update(tmpl, path)
+	return sources
+}
+
+// update attributes all templates of the set that were added or redefined
+// since the last update to the file at path.
+func (s *templateSources) update(tmpl *template.Template, path string) {
+	var duplicates []duplicate
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || s.trees[t.Name()] == t.Tree {
+			continue
+		}
+		if previous, ok := s.paths[t.Name()]; ok && previous != path {
+			duplicates = append(duplicates, duplicate{name: t.Name(), path: path, shadowed: previous})
+		}
+		s.trees[t.Name()] = t.Tree
+		s.paths[t.Name()] = path
+	}
+
+	// Templates are returned in random order
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].name < duplicates[j].name
+	})
+	s.duplicates = append(s.duplicates, duplicates...)
+}
+
+// reportDuplicates returns an error naming all duplicate templates of a
+// document, or logs the ones not logged for another document before, depending
+// on the configured handling.
+func (r *Renderer) reportDuplicates(duplicates []duplicate) error {
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	if r.duplicates == config.DuplicatesError {
+		messages := make([]string, len(duplicates))
+		for i, d := range duplicates {
+			messages[i] = fmt.Sprintf("%q in %s and %s", d.name, d.shadowed, d.path)
+		}
+		return errors.Wrapf(ErrDuplicateDefinition, "%s", strings.Join(messages, ", "))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range duplicates {
+		if r.reported[d] {
+			continue
+		}
+		r.reported[d] = true
+		slog.Warn("Template is defined more than once, the later definition is used", "template", d.name, "path", d.path, "shadowed", d.shadowed)
+	}
+	return nil
+}
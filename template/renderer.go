@@ -1,9 +1,9 @@
 package template
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"sync"
 	"text/template"
 
 	"github.com/friendsofgo/errors"
@@ -12,17 +12,55 @@ import (
 	"github.com/go-sprout/sprout/registry/numeric"
 	"github.com/go-sprout/sprout/registry/strings"
 	"github.com/networkteam/slogutils"
+
+	"github.com/esdete2/envelopr/config"
 )
 
 type Renderer struct {
-	documents []Template
-	partials  []Template
-	sprout    sprout.Handler
+	documents  []Template
+	partials   []Template
+	sprout     sprout.Handler
+	duplicates string
+	escape     string
+	limits     Limits
+	restricted bool
+	format     Format
+	assets     Assets
+	head       string
+	styles     map[string]string
+	event      string
+
+	// mu guards reported, the duplicate templates already logged
+	mu       sync.Mutex
+	reported map[duplicate]bool
 }
 
 var ErrTemplateNotFound = errors.New("template not found")
+var ErrDuplicateDefinition = errors.New("duplicate template definition")
 
-func NewRenderer(documents, partials []Template) *Renderer {
+type RendererOption func(*Renderer)
+
+// WithDuplicates sets the handling of templates defined in more than one file,
+// config.DuplicatesWarn or config.DuplicatesError. Duplicates are logged by
+// default.
+func WithDuplicates(mode string) RendererOption {
+	return func(r *Renderer) {
+		r.duplicates = mode
+	}
+}
+
+// WithEscape sets the escaping of values written by templates, config.EscapeHTML
+// or config.EscapeNone. Values are escaped by default.
+func WithEscape(mode string) RendererOption {
+	return func(r *Renderer) {
+		r.escape = mode
+	}
+}
+
+// NewRenderer creates a renderer for the documents. Partials are added to the
+// template set of a document sorted by name, so that the definition used for a
+// duplicate template does not depend on the order of the partials.
+func NewRenderer(documents, partials []Template, opts ...RendererOption) *Renderer {
 	logger := slogutils.FromContext(context.Background())
 	sproutHandler := sprout.New(
 		sprout.WithLogger(logger),
@@ -33,49 +71,156 @@ func NewRenderer(documents, partials []Template) *Renderer {
 		),
 	)
 
-	return &Renderer{
-		documents: documents,
-		partials:  partials,
-		sprout:    sproutHandler,
+	renderer := &Renderer{
+		documents:  documents,
+		partials:   partials,
+		sprout:     sproutHandler,
+		duplicates: config.DuplicatesWarn,
+		escape:     config.EscapeHTML,
+		reported:   make(map[duplicate]bool),
+	}
+	for _, opt := range opts {
+		opt(renderer)
 	}
+	return renderer
 }
 
 func (r *Renderer) Render(name string, data any) (string, error) {
-	// Find the document
-	var doc *Template
+	return r.RenderContext(context.Background(), name, data)
+}
+
+// RenderContext renders a document like Render and stops when ctx is done. The
+// timeout of the limits is applied on top of ctx.
+func (r *Renderer) RenderContext(ctx context.Context, name string, data any) (string, error) {
+	if r.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.limits.Timeout)
+		defer cancel()
+	}
+	exec := &execution{ctx: ctx, limits: r.limits}
+	contracts := make(contracts)
+
+	doc, err := r.document(name)
+	if err != nil {
+		return "", err
+	}
+
+	format, err := r.format.forData(data)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, sources, partials, err := r.parse(doc, r.funcs(format, exec, contracts)...)
+	if err != nil {
+		return "", err
+	}
+	if err := r.reportDuplicates(sources.duplicates); err != nil {
+		return "", err
+	}
+
+	// Validate the calls of partials declaring parameters
+	for _, p := range partials {
+		if len(p.FrontMatter.Params) > 0 && sources.paths[p.Name] == p.source() {
+			contracts[p.Name] = p.FrontMatter.Params
+		}
+	}
+	contracts.checkCalls(tmpl, sources)
+
+	// Escape values depending on where they are written in the HTML
+	if r.escape != config.EscapeNone {
+		if err := escapeTemplates(tmpl); err != nil {
+			return "", err
+		}
+	}
+
+	rendered, err := exec.execute(tmpl, data)
+	if err != nil {
+		var execErr template.ExecError
+		if errors.As(err, &execErr) && sources.paths[unescapedName(execErr.Name)] != "" {
+			name := unescapedName(execErr.Name)
+			return "", errors.Wrapf(err, "executing template %s from %s", name, sources.paths[name])
+		}
+		return "", errors.Wrap(err, "executing template")
+	}
+
+	if r.addsHead(doc) {
+		fragments, err := exec.execute(tmpl.Lookup(headTemplate), data)
+		if err != nil {
+			return "", errors.Wrapf(err, "executing %s", headSource)
+		}
+		rendered = injectHead(rendered, fragments)
+	}
+
+	return rendered, nil
+}
+
+// document returns the document with the name.
+func (r *Renderer) document(name string) (*Template, error) {
 	for _, d := range r.documents {
 		if d.Name == name {
-			doc = &d
-			break
+			return &d, nil
 		}
 	}
-	if doc == nil {
-		return "", errors.Wrapf(ErrTemplateNotFound, "template: %s", name)
+	return nil, errors.Wrapf(ErrTemplateNotFound, "template: %s", name)
+}
+
+// funcs returns the functions of the templates rendered with the format.
+func (r *Renderer) funcs(format Format, exec *execution, contracts contracts) []template.FuncMap {
+	sproutFuncs := r.sprout.Build()
+	if r.restricted {
+		sproutFuncs = restrict(sproutFuncs)
+	}
+	return []template.FuncMap{
+		customTemplateFuncs(),
+		escapeFuncs(),
+		sproutFuncs,
+		FormatFuncs(format),
+		barcodeFuncs(r.assets, r.restricted),
+		calendarFuncs(format),
+		msoFuncs(),
+		styleFuncs(r.styles),
+		exec.funcs(r.restricted),
+		contracts.funcs(),
 	}
+}
 
-	// Create template with main content
-	tmpl, err := template.New(doc.Name).
-		Funcs(customTemplateFuncs()).
-		Funcs(r.sprout.Build()).
-		Parse(doc.Content)
-	if err != nil {
-		return "", errors.Wrap(err, "parsing main template")
+// parse parses the document with the partials visible to it and the head
+// fragments it uses. It returns the partials, later ones replacing the
+// templates of earlier ones, the duplicates are recorded in the sources.
+func (r *Renderer) parse(doc *Template, funcs ...template.FuncMap) (*template.Template, *templateSources, []Template, error) {
+	tmpl := template.New(doc.Name)
+	for _, f := range funcs {
+		tmpl.Funcs(f)
+	}
+	if _, err := tmpl.Parse(doc.Content); err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "parsing main template %s", doc.Path)
 	}
+	sources := newTemplateSources(tmpl, doc.source())
 
-	// Add all partials
-	for _, p := range r.partials {
+	// Add the partials visible to the document
+	partials := r.partialsFor(doc.Name)
+	for _, p := range partials {
 		_, err := tmpl.New(p.Name).Parse(p.Content)
 		if err != nil {
-			return "", errors.Wrap(err, "parsing partial template")
+			return nil, nil, nil, errors.Wrapf(err, "parsing partial template %s", p.Path)
 		}
+		sources.update(tmpl, p.source())
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return "", errors.Wrap(err, "executing template")
+	// Add the head fragments of the config, they may call partials
+	if r.addsHead(doc) {
+		if _, err := tmpl.New(headTemplate).Parse(r.head); err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "parsing %s", headSource)
+		}
+		sources.update(tmpl, headSource)
 	}
 
-	return buf.String(), nil
+	return tmpl, sources, partials, nil
+}
+
+// addsHead reports whether the head fragments are added to the document.
+func (r *Renderer) addsHead(doc *Template) bool {
+	return r.head != "" && doc.usesHead()
 }
 
 func (r *Renderer) Documents() []Template {
@@ -83,8 +228,8 @@ func (r *Renderer) Documents() []Template {
 }
 
 func customTemplateFuncs() template.FuncMap {
-	exp := func(expression string) string {
-		return fmt.Sprintf("{{ %s }}", expression)
+	exp := func(expression string) HTML {
+		return HTML(fmt.Sprintf("{{ %s }}", expression))
 	}
 	return template.FuncMap{
 		"expression": exp,
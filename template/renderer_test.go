@@ -1,10 +1,17 @@
 package template_test
 
 import (
+	"bytes"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/esdete2/envelopr/config"
 	"github.com/esdete2/envelopr/template"
 )
 
@@ -176,4 +183,420 @@ func TestRenderer(t *testing.T) {
 		r.Contains(result, `href="{{ .profileUrl }}"`)
 		r.Contains(result, `{{ .buttonText }}`)
 	})
+
+	t.Run("local partials", func(t *testing.T) {
+		r := require.New(t)
+
+		docs := []template.Template{
+			{Name: "welcome", Content: `{{template "header" .}}`},
+			{Name: "campaign/launch", Content: `{{template "header" .}}`},
+			{Name: "campaign/spring/sale", Content: `{{template "header" .}}`},
+			{Name: "news/weekly", Content: `{{template "header" .}}`},
+		}
+
+		partials := []template.Template{
+			{Name: "header", Content: `global`},
+			{Name: "header", Content: `campaign`, Local: true, Scope: "campaign"},
+			{Name: "header", Content: `spring`, Local: true, Scope: "campaign/spring"},
+			{Name: "header", Content: `camp`, Local: true, Scope: "camp"},
+		}
+
+		renderer := template.NewRenderer(docs, partials)
+		for name, expected := range map[string]string{
+			"welcome":              "global",
+			"campaign/launch":      "campaign",
+			"campaign/spring/sale": "spring",
+			"news/weekly":          "global",
+		} {
+			result, err := renderer.Render(name, nil)
+			r.NoError(err)
+			r.Equal(expected, result, name)
+		}
+	})
+
+	t.Run("error names the partial file", func(t *testing.T) {
+		r := require.New(t)
+
+		docs := []template.Template{
+			{Name: "welcome", Path: "documents/welcome.mjml", Content: `{{template "header" .}}`},
+		}
+
+		partials := []template.Template{
+			{Name: "header", Path: "partials/header.mjml", Content: `{{define "logo"}}{{.missing.url}}{{end}}{{template "logo" .}}`},
+		}
+
+		renderer := template.NewRenderer(docs, partials)
+		_, err := renderer.Render("welcome", map[string]any{"missing": "text"})
+		r.ErrorContains(err, "executing template logo from partials/header.mjml")
+	})
+
+	t.Run("partial parameters", func(t *testing.T) {
+		r := require.New(t)
+
+		button, err := parsePartial("button", "partials/button.mjml", `---
+params:
+  - name: url
+    type: string
+    required: true
+  - name: label
+    type: string
+    default: Shop Now
+  - name: width
+    type: number
+---
+<mj-button href="{{ .url }}">{{ .label }}</mj-button>`)
+		r.NoError(err)
+
+		docs := []template.Template{
+			{Name: "valid", Path: "documents/valid.mjml", Content: `{{ template "button" dict "url" "https://example.com" }}`},
+			{Name: "missing", Path: "documents/missing.mjml", Content: "<mj-text>\n{{ if true }}{{ template \"button\" dict \"label\" \"Buy\" }}{{ end }}"},
+			{Name: "wrong-type", Path: "documents/wrong-type.mjml", Content: `{{ template "button" dict "url" "/" "width" "wide" }}`},
+			{Name: "nested", Path: "documents/nested.mjml", Content: `{{ template "card" . }}`},
+		}
+		partials := []template.Template{
+			button,
+			{Name: "card", Path: "partials/card.mjml", Content: "<mj-column>\n\n{{ template \"button\" }}</mj-column>"},
+		}
+		renderer := template.NewRenderer(docs, partials)
+
+		result, err := renderer.Render("valid", nil)
+		r.NoError(err)
+		r.Equal(`<mj-button href="https://example.com">Shop Now</mj-button>`, strings.TrimSpace(result))
+
+		_, err = renderer.Render("missing", nil)
+		r.ErrorIs(err, template.ErrInvalidParams)
+		r.ErrorContains(err, `partial "button" called from documents/missing.mjml:2: missing required parameter "url"`)
+
+		_, err = renderer.Render("wrong-type", nil)
+		r.ErrorContains(err, `parameter "width" expects a number, got wide`)
+
+		_, err = renderer.Render("nested", nil)
+		r.ErrorContains(err, "called from partials/card.mjml:3")
+	})
+
+	t.Run("head fragments", func(t *testing.T) {
+		r := require.New(t)
+
+		optOut, err := parsePartial("opt-out", "documents/opt-out.mjml", "---\nhead: false\n---\n<mjml><mj-body /></mjml>")
+		r.NoError(err)
+
+		docs := []template.Template{
+			{Name: "with-head", Content: `<mjml><mj-head><mj-title>{{ .title }}</mj-title></mj-head><mj-body /></mjml>`},
+			{Name: "without-head", Content: `<mjml lang="en"><mj-body /></mjml>`},
+			{Name: "plain", Content: `<html><head></head></html>`, HTML: true},
+			optOut,
+		}
+		partials := []template.Template{
+			{Name: "breakpoint", Content: `<mj-breakpoint width="{{ .breakpoint }}" />`},
+		}
+		renderer := template.NewRenderer(docs, partials,
+			template.WithHead(`<mj-attributes><mj-all font-family="Arial" /></mj-attributes>{{ template "breakpoint" . }}`),
+			template.WithLimits(template.Limits{MaxDepth: 5}))
+		data := map[string]any{"title": "Hello", "breakpoint": "480px"}
+
+		result, err := renderer.Render("with-head", data)
+		r.NoError(err)
+		r.Equal(`<mjml><mj-head><mj-attributes><mj-all font-family="Arial" /></mj-attributes><mj-breakpoint width="480px" />`+
+			`<mj-title>Hello</mj-title></mj-head><mj-body /></mjml>`, result)
+
+		result, err = renderer.Render("without-head", data)
+		r.NoError(err)
+		r.Equal(`<mjml lang="en"><mj-head><mj-attributes><mj-all font-family="Arial" /></mj-attributes><mj-breakpoint width="480px" />`+
+			`</mj-head><mj-body /></mjml>`, result)
+
+		result, err = renderer.Render("plain", data)
+		r.NoError(err)
+		r.Equal(`<html><head></head></html>`, result)
+
+		result, err = renderer.Render("opt-out", data)
+		r.NoError(err)
+		r.Equal("<mjml><mj-body /></mjml>", result)
+	})
+
+	t.Run("duplicate definitions", func(t *testing.T) {
+		r := require.New(t)
+
+		docs := []template.Template{
+			{Name: "welcome", Path: "documents/welcome.mjml", Content: `{{template "layout" .}}`},
+		}
+
+		partials := []template.Template{
+			{Name: "sidebar", Path: "partials/sidebar.mjml", Content: `{{define "content"}}sidebar{{end}}`},
+			{Name: "layout", Path: "partials/layout.mjml", Content: `{{template "content" .}}`},
+			{Name: "article", Path: "partials/article.mjml", Content: `{{define "content"}}article{{end}}`},
+		}
+
+		// Partials are added by name, independent of their order
+		renderer := template.NewRenderer(docs, partials)
+		result, err := renderer.Render("welcome", nil)
+		r.NoError(err)
+		r.Equal("sidebar", result)
+
+		slices.Reverse(partials)
+		renderer = template.NewRenderer(docs, partials)
+		result, err = renderer.Render("welcome", nil)
+		r.NoError(err)
+		r.Equal("sidebar", result)
+
+		renderer = template.NewRenderer(docs, partials, template.WithDuplicates(config.DuplicatesError))
+		_, err = renderer.Render("welcome", nil)
+		r.ErrorIs(err, template.ErrDuplicateDefinition)
+		r.ErrorContains(err, `"content" in partials/article.mjml and partials/sidebar.mjml`)
+
+		// A partial named like a define block of the document
+		docs[0].Content = `{{define "layout"}}own{{end}}{{template "layout" .}}`
+		renderer = template.NewRenderer(docs, partials, template.WithDuplicates(config.DuplicatesError))
+		_, err = renderer.Render("welcome", nil)
+		r.ErrorContains(err, `"layout" in documents/welcome.mjml and partials/layout.mjml`)
+	})
+
+	t.Run("duplicates are logged once", func(t *testing.T) {
+		r := require.New(t)
+
+		var logs bytes.Buffer
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+		docs := []template.Template{
+			{Name: "welcome", Content: `{{template "content" .}}`},
+			{Name: "reset", Content: `{{template "content" .}}`},
+		}
+		partials := []template.Template{
+			{Name: "sidebar", Path: "partials/sidebar.mjml", Content: `{{define "content"}}sidebar{{end}}`},
+			{Name: "article", Path: "partials/article.mjml", Content: `{{define "content"}}article{{end}}`},
+		}
+
+		renderer := template.NewRenderer(docs, partials)
+		for _, doc := range renderer.Documents() {
+			_, err := renderer.Render(doc.Name, nil)
+			r.NoError(err)
+		}
+		r.Equal(1, strings.Count(logs.String(), "Template is defined more than once"))
+	})
+
+	t.Run("local partials are no duplicates", func(t *testing.T) {
+		r := require.New(t)
+
+		docs := []template.Template{
+			{Name: "campaign/launch", Content: `{{template "header" .}}`},
+		}
+
+		partials := []template.Template{
+			{Name: "header", Path: "partials/header.mjml", Content: `global`},
+			{Name: "header", Path: "documents/campaign/_header.mjml", Content: `local`, Local: true, Scope: "campaign"},
+		}
+
+		renderer := template.NewRenderer(docs, partials, template.WithDuplicates(config.DuplicatesError))
+		result, err := renderer.Render("campaign/launch", nil)
+		r.NoError(err)
+		r.Equal("local", result)
+	})
+}
+
+func TestRenderer_Escape(t *testing.T) {
+	render := func(t *testing.T, content string, data any, opts ...template.RendererOption) (string, error) {
+		t.Helper()
+		renderer := template.NewRenderer([]template.Template{{Name: "doc", Content: content}}, nil, opts...)
+		return renderer.Render("doc", data)
+	}
+
+	data := map[string]any{
+		"text":  `<b>Tom & "Jerry"</b>`,
+		"url":   `https://example.com/?a=1&b=2`,
+		"js":    `javascript:alert(1)`,
+		"space": `a b`,
+		"font":  `"Open Sans", sans-serif`,
+		"close": `</mj-style><mj-raw>`,
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"text", `<mj-text>{{ .text }}</mj-text>`, `<mj-text>&lt;b&gt;Tom &amp; "Jerry"&lt;/b&gt;</mj-text>`},
+		{"quoted attribute", `<mj-image alt="{{ .text }}" />`, `<mj-image alt="&lt;b&gt;Tom &amp; &#34;Jerry&#34;&lt;/b&gt;" />`},
+		{"single quoted attribute", `<mj-image alt='{{ .text }}' />`, `<mj-image alt='&lt;b&gt;Tom &amp; &#34;Jerry&#34;&lt;/b&gt;' />`},
+		{"unquoted attribute", `<mj-image alt={{ .space }}>`, `<mj-image alt=a&#32;b>`},
+		{"url", `<mj-button href="{{ .url }}">`, `<mj-button href="https://example.com/?a=1&amp;b=2">`},
+		{"unsafe url", `<mj-button href="{{ .js }}">`, `<mj-button href="#ZgotmplZ">`},
+		{"mjml url attribute", `<mj-section background-url="{{ .js }}">`, `<mj-section background-url="#ZgotmplZ">`},
+		{"after attribute", `<a href="{{ .url }}" title="x">{{ .text }}</a>`, `<a href="https://example.com/?a=1&amp;b=2" title="x">&lt;b&gt;Tom &amp; "Jerry"&lt;/b&gt;</a>`},
+		{"comment", `<!-- {{ .text }} -->`, `<!-- &lt;b&gt;Tom &amp; "Jerry"&lt;/b&gt; -->`},
+		{"safe", `<mj-text>{{ .text | safe }}</mj-text>`, `<mj-text><b>Tom & "Jerry"</b></mj-text>`},
+		{"raw", `<mj-text>{{ raw .text }}</mj-text>`, `<mj-text><b>Tom & "Jerry"</b></mj-text>`},
+		{"expression", `<mj-button href="{{ exp ".url" }}">`, `<mj-button href="{{ .url }}">`},
+		{"branches", `{{ if .text }}<a href="{{ .js }}">{{ else }}<a href="/">{{ end }}{{ .text }}</a>`, `<a href="#ZgotmplZ">&lt;b&gt;Tom &amp; "Jerry"&lt;/b&gt;</a>`},
+		{"assignment", `{{ $x := .text }}<b title="{{ $x }}"></b>`, `<b title="&lt;b&gt;Tom &amp; &#34;Jerry&#34;&lt;/b&gt;"></b>`},
+		{"style element", `<mj-style inline="inline">.title > a { font-family: {{ .font }}; }</mj-style>`, `<mj-style inline="inline">.title > a { font-family: "Open Sans", sans-serif; }</mj-style>`},
+		{"closing style element", `<style>{{ .close }}</style>`, `<style>\3c /mj-style>\3c mj-raw></style>`},
+		{"after style element", `<STYLE>{{ .font }}</STYLE>{{ .text }}`, `<STYLE>"Open Sans", sans-serif</STYLE>&lt;b&gt;Tom &amp; "Jerry"&lt;/b&gt;`},
+		{"safe script", `<script>{{ "alert(1)" | safe }}</script>`, `<script>alert(1)</script>`},
+		{"template contexts", `{{ define "title" }}{{ .text }}{{ end }}<mj-image alt="{{ template "title" . }}" /><mj-text>{{ template "title" . }}</mj-text>`, `<mj-image alt="&lt;b&gt;Tom &amp; &#34;Jerry&#34;&lt;/b&gt;" /><mj-text>&lt;b&gt;Tom &amp; "Jerry"&lt;/b&gt;</mj-text>`},
+		{"template in style element", `{{ define "font" }}{{ .font }}{{ end }}<mj-style>p { font-family: {{ template "font" . }}; }</mj-style>`, `<mj-style>p { font-family: "Open Sans", sans-serif; }</mj-style>`},
+		{"template ending in attribute", `{{ define "open" }}<a href="{{ end }}{{ template "open" }}{{ .js }}">{{ .text }}</a>`, `<a href="#ZgotmplZ">&lt;b&gt;Tom &amp; "Jerry"&lt;/b&gt;</a>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+
+			result, err := render(t, tt.content, data)
+			r.NoError(err)
+			r.Equal(tt.expected, result)
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		r := require.New(t)
+
+		result, err := render(t, `<mj-button href="{{ .js }}">{{ .text }}</mj-button>`, data, template.WithEscape(config.EscapeNone))
+		r.NoError(err)
+		r.Equal(`<mj-button href="javascript:alert(1)"><b>Tom & "Jerry"</b></mj-button>`, result)
+	})
+
+	t.Run("script", func(t *testing.T) {
+		_, err := render(t, `<script>var name = "{{ .text }}";</script>`, data)
+		require.ErrorIs(t, err, template.ErrEscaping)
+	})
+
+	t.Run("recursive template", func(t *testing.T) {
+		r := require.New(t)
+
+		tree := map[string]any{"text": "<a>", "items": []any{map[string]any{"text": "<b>"}}}
+		result, err := render(t, `{{ define "item" }}<li title="{{ .text }}">{{ .text }}{{ range .items }}<ul>{{ template "item" . }}</ul>{{ end }}</li>{{ end }}{{ template "item" . }}`, tree)
+		r.NoError(err)
+		r.Equal(`<li title="&lt;a&gt;">&lt;a&gt;<ul><li title="&lt;b&gt;">&lt;b&gt;</li></ul></li>`, result)
+
+		_, err = render(t, `{{ define "open" }}{{ if . }}{{ template "open" }}<b title="{{ else }}<b title="{{ end }}{{ end }}{{ template "open" . }}`, tree)
+		r.ErrorIs(err, template.ErrEscaping)
+		r.ErrorContains(err, "recursive template")
+	})
+
+	t.Run("ambiguous context", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := render(t, `{{ if .text }}<a href="{{ end }}{{ .url }}">`, data)
+		r.ErrorIs(err, template.ErrEscaping)
+		r.ErrorContains(err, "doc:1:")
+	})
+}
+
+func TestRenderer_Limits(t *testing.T) {
+	render := func(t *testing.T, docs, partials []template.Template, opts ...template.RendererOption) (string, error) {
+		t.Helper()
+		renderer := template.NewRenderer(docs, partials, opts...)
+		return renderer.Render(docs[0].Name, map[string]any{"items": make([]int, 100), "fn": func() string { return "called" }})
+	}
+
+	t.Run("output size", func(t *testing.T) {
+		r := require.New(t)
+
+		docs := []template.Template{{Name: "doc", Content: `{{ range .items }}0123456789{{ end }}`}}
+		result, err := render(t, docs, nil, template.WithLimits(template.Limits{MaxOutputSize: 1000}))
+		r.NoError(err)
+		r.Len(result, 1000)
+
+		_, err = render(t, docs, nil, template.WithLimits(template.Limits{MaxOutputSize: 999}))
+		r.ErrorIs(err, template.ErrLimitExceeded)
+
+		docs = []template.Template{{Name: "doc", Content: `{{ repeat 1000000000 "spam" }}`}}
+		_, err = render(t, docs, nil, template.WithLimits(template.Limits{MaxOutputSize: 1000}))
+		r.ErrorIs(err, template.ErrLimitExceeded)
+	})
+
+	t.Run("value size", func(t *testing.T) {
+		opts := map[string]template.RendererOption{
+			"restricted": template.WithRestricted(),
+			"timeout":    template.WithLimits(template.Limits{Timeout: time.Minute}),
+		}
+		values := []string{
+			`{{ $s := repeat 10000000000 "x" }}`,
+			`{{ $s := indent 10000000000 "x" }}`,
+			`{{ $s := nindent 100000 (repeat 1000 "\n") }}`,
+			`{{ $s := replace "x" (repeat 100000 "y") (repeat 1000 "x") }}`,
+			`{{ $s := wrapWith 1 (repeat 100000 "-") (repeat 1000 "x") }}`,
+			`{{ $s := seq 10000000000 }}`,
+		}
+		for name, opt := range opts {
+			for _, value := range values {
+				t.Run(name+" "+value, func(t *testing.T) {
+					docs := []template.Template{{Name: "doc", Content: value}}
+					_, err := render(t, docs, nil, opt)
+					require.ErrorIs(t, err, template.ErrLimitExceeded)
+				})
+			}
+		}
+
+		r := require.New(t)
+		docs := []template.Template{{Name: "doc", Content: `{{ seq 3 }} {{ seq 5 -2 1 }} {{ repeat 3 "ab" | indent 2 }}`}}
+		result, err := render(t, docs, nil, template.WithRestricted())
+		r.NoError(err)
+		r.Equal("1 2 3 5 3 1   ababab", result)
+	})
+
+	t.Run("nesting depth", func(t *testing.T) {
+		r := require.New(t)
+
+		docs := []template.Template{{Name: "doc", Content: `{{ template "a" . }}`}}
+		partials := []template.Template{
+			{Name: "a", Content: `a{{ template "b" . }}`},
+			{Name: "b", Content: `b`},
+		}
+		result, err := render(t, docs, partials, template.WithLimits(template.Limits{MaxDepth: 3}))
+		r.NoError(err)
+		r.Equal("ab", result)
+
+		_, err = render(t, docs, partials, template.WithLimits(template.Limits{MaxDepth: 2}))
+		r.ErrorIs(err, template.ErrLimitExceeded)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r := require.New(t)
+
+		// Recursion without output only stops at the nesting limit of text/template
+		docs := []template.Template{{Name: "doc", Content: `{{ template "loop" . }}`}}
+		partials := []template.Template{{Name: "loop", Content: `{{ range .items }}{{ template "loop" $ }}{{ end }}`}}
+		_, err := render(t, docs, partials, template.WithLimits(template.Limits{Timeout: 50 * time.Millisecond}))
+		r.ErrorIs(err, template.ErrLimitExceeded)
+		r.ErrorContains(err, "longer than 50ms")
+
+		// Loops without output are stopped, not only abandoned
+		before := runtime.NumGoroutine()
+		docs = []template.Template{{Name: "doc", Content: `{{ range 2000000000 }}{{ end }}`}}
+		_, err = render(t, docs, nil, template.WithLimits(template.Limits{Timeout: 50 * time.Millisecond}))
+		r.ErrorIs(err, template.ErrLimitExceeded)
+		r.Eventually(func() bool {
+			return runtime.NumGoroutine() <= before
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("restricted", func(t *testing.T) {
+		r := require.New(t)
+
+		docs := []template.Template{{Name: "doc", Content: `{{ call .fn }}`}}
+		result, err := render(t, docs, nil)
+		r.NoError(err)
+		r.Equal("called", result)
+
+		_, err = render(t, docs, nil, template.WithRestricted())
+		r.ErrorIs(err, template.ErrRestricted)
+
+		// Functions are allowed explicitly, the functions of envelopr stay available
+		docs = []template.Template{{Name: "doc", Content: `{{ printf "%s" (toUpper "a") }}{{ number 1234 }}{{ len .items }}`}}
+		result, err = render(t, docs, nil, template.WithRestricted())
+		r.NoError(err)
+		r.Equal("A1,234100", result)
+
+		allowed := template.AllowedRestrictedFuncs
+		t.Cleanup(func() { template.AllowedRestrictedFuncs = allowed })
+		template.AllowedRestrictedFuncs = slices.DeleteFunc(slices.Clone(allowed), func(name string) bool { return name == "toUpper" })
+		_, err = render(t, docs, nil, template.WithRestricted())
+		r.ErrorIs(err, template.ErrRestricted)
+		r.ErrorContains(err, "function toUpper")
+	})
+}
+
+func parsePartial(name, path, content string) (template.Template, error) {
+	frontMatter, body, err := template.ParseFrontMatter(content)
+	return template.Template{Name: name, Path: path, Content: body, FrontMatter: frontMatter}, err
 }
@@ -0,0 +1,175 @@
+package template
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/friendsofgo/errors"
+)
+
+var ErrStyleNotFound = errors.New("stylesheet not found")
+
+// headStylePrefix is the prefix of the names of the head fragment stylesheets,
+// which the stylesheet functions of templates do not include.
+const headStylePrefix = "_envelopr_head:"
+
+// headStyleFunc is the name of the function including head fragment
+// stylesheets.
+const headStyleFunc = "_envelopr_headStyle"
+
+// WithStyles sets the CSS files that templates include by name, the path in the
+// styles directory without extension.
+func WithStyles(styles map[string]string) RendererOption {
+	return func(r *Renderer) {
+		r.styles = styles
+	}
+}
+
+// HeadStyle returns the name of a CSS file of the head fragments in the styles
+// of the renderer.
+func HeadStyle(path string) string {
+	return headStylePrefix + filepath.ToSlash(filepath.Clean(path))
+}
+
+// HeadStylesheet returns the head fragment including the CSS file at path,
+// added to the styles by its HeadStyle name.
+func HeadStylesheet(path string, inline bool) string {
+	return fmt.Sprintf("{{ %s %q %t }}", headStyleFunc, HeadStyle(path), inline)
+}
+
+// styleFuncs returns the functions including CSS files in mj-style, names may
+// have the .css extension:
+//
+//	<mj-head>
+//	  {{ stylesheet "dark-mode" }}
+//	  {{ inlineStylesheet "utilities.css" }}  moved into style attributes by MJML
+//	</mj-head>
+func styleFuncs(styles map[string]string) template.FuncMap {
+	style := func(name string, inline bool) (HTML, error) {
+		css, ok := styles[name]
+		if !ok {
+			return "", errors.Wrapf(ErrStyleNotFound, "stylesheet: %s", name)
+		}
+		if inline {
+			return HTML(`<mj-style inline="inline">` + css + "</mj-style>"), nil
+		}
+		return HTML("<mj-style>" + css + "</mj-style>"), nil
+	}
+	stylesheet := func(name string, inline bool) (HTML, error) {
+		if strings.HasPrefix(name, headStylePrefix) {
+			return "", errors.Wrapf(ErrStyleNotFound, "stylesheet: %s", name)
+		}
+		return style(strings.TrimSuffix(name, ".css"), inline)
+	}
+
+	return template.FuncMap{
+		"stylesheet": func(name string) (HTML, error) {
+			return stylesheet(name, false)
+		},
+		"inlineStylesheet": func(name string) (HTML, error) {
+			return stylesheet(name, true)
+		},
+		headStyleFunc: style,
+	}
+}
+
+// UsesStyle reports whether the document includes the stylesheet, itself, in
+// the partials it calls or in the head fragments. A stylesheet included by a
+// name that is not a string literal may be any stylesheet and counts as used.
+func (r *Renderer) UsesStyle(name, style string) (bool, error) {
+	doc, err := r.document(name)
+	if err != nil {
+		return false, err
+	}
+
+	tmpl, _, _, err := r.parse(doc, r.funcs(r.format, &execution{}, make(contracts))...)
+	if err != nil {
+		return false, err
+	}
+
+	u := &styleUsage{
+		tmpl:    tmpl,
+		style:   strings.TrimSuffix(style, ".css"),
+		visited: make(map[string]bool),
+	}
+	u.template(doc.Name)
+	if r.addsHead(doc) {
+		u.template(headTemplate)
+	}
+	return u.found, nil
+}
+
+// styleUsage walks the templates called by a document looking for a
+// stylesheet.
+type styleUsage struct {
+	tmpl    *template.Template
+	style   string
+	visited map[string]bool
+	found   bool
+}
+
+func (u *styleUsage) template(name string) {
+	if u.found || u.visited[name] {
+		return
+	}
+	u.visited[name] = true
+	if t := u.tmpl.Lookup(name); t != nil && t.Tree != nil {
+		u.list(t.Tree.Root)
+	}
+}
+
+func (u *styleUsage) list(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.ActionNode:
+			u.pipe(node.Pipe)
+		case *parse.TemplateNode:
+			u.pipe(node.Pipe)
+			u.template(node.Name)
+		case *parse.IfNode:
+			u.branch(&node.BranchNode)
+		case *parse.RangeNode:
+			u.branch(&node.BranchNode)
+		case *parse.WithNode:
+			u.branch(&node.BranchNode)
+		case *parse.ListNode:
+			u.list(node)
+		}
+	}
+}
+
+func (u *styleUsage) branch(node *parse.BranchNode) {
+	u.pipe(node.Pipe)
+	u.list(node.List)
+	u.list(node.ElseList)
+}
+
+func (u *styleUsage) pipe(pipe *parse.PipeNode) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+		if ok && (ident.Ident == "stylesheet" || ident.Ident == "inlineStylesheet" || ident.Ident == headStyleFunc) {
+			// The name is the first argument, or piped if it is missing
+			var name *parse.StringNode
+			if len(cmd.Args) > 1 {
+				name, _ = cmd.Args[1].(*parse.StringNode)
+			}
+			if name == nil || strings.TrimSuffix(name.Text, ".css") == u.style {
+				u.found = true
+			}
+		}
+		for _, arg := range cmd.Args {
+			if arg, ok := arg.(*parse.PipeNode); ok {
+				u.pipe(arg)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package template_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/esdete2/envelopr/config"
+	"github.com/esdete2/envelopr/template"
+)
+
+func TestStyleFuncs(t *testing.T) {
+	r := require.New(t)
+
+	docs := []template.Template{
+		{Name: "doc", Content: `<mj-head>{{ stylesheet "themes/dark" }}{{ inlineStylesheet "utilities.css" }}</mj-head>`},
+		{Name: "missing", Content: `{{ stylesheet "print" }}`},
+	}
+	renderer := template.NewRenderer(docs, nil, template.WithStyles(map[string]string{
+		"themes/dark": `@media (prefers-color-scheme: dark) { .title { color: #fff; } }`,
+		"utilities":   `a[href^="https"] > .icon { display: none; }`,
+	}))
+
+	result, err := renderer.Render("doc", nil)
+	r.NoError(err)
+	r.Equal(`<mj-head><mj-style>@media (prefers-color-scheme: dark) { .title { color: #fff; } }</mj-style>`+
+		`<mj-style inline="inline">a[href^="https"] > .icon { display: none; }</mj-style></mj-head>`, result)
+
+	_, err = renderer.Render("missing", nil)
+	r.ErrorIs(err, template.ErrStyleNotFound)
+
+	// Head fragment stylesheets are only included by the head
+	docs = []template.Template{
+		{Name: "brand", Content: `<mjml></mjml>`},
+		{Name: "head", Content: `{{ stylesheet "` + template.HeadStyle("/styles/brand.css") + `" }}`},
+	}
+	renderer = template.NewRenderer(docs, nil,
+		template.WithStyles(map[string]string{template.HeadStyle("/styles/brand.css"): `.brand { color: #f60; }`}),
+		template.WithHead(template.HeadStylesheet("/styles/brand.css", false)),
+	)
+	_, err = renderer.Render("head", nil)
+	r.ErrorIs(err, template.ErrStyleNotFound)
+	result, err = renderer.Render("brand", nil)
+	r.NoError(err)
+	r.Equal(`<mjml><mj-head><mj-style>.brand { color: #f60; }</mj-style></mj-head></mjml>`, result)
+}
+
+func TestRenderer_UsesStyle(t *testing.T) {
+	docs := []template.Template{
+		{Name: "direct", Content: `<mjml><mj-head>{{ stylesheet "dark.css" }}</mj-head></mjml>`},
+		{Name: "partial", Content: `<mjml>{{ if .dark }}{{ template "theme" . }}{{ end }}</mjml>`},
+		{Name: "dynamic", Content: `<mjml>{{ .theme | inlineStylesheet }}</mjml>`},
+		{Name: "head", Content: `<mjml></mjml>`},
+		{Name: "plain", Content: `<mjml>{{ template "footer" . }}</mjml>`},
+		{Name: "optout", Content: "<mjml></mjml>", FrontMatter: template.FrontMatter{Head: new(bool)}},
+	}
+	partials := []template.Template{
+		{Name: "theme", Content: `{{ with .colors }}{{ (stylesheet "dark") | print }}{{ end }}`},
+		{Name: "footer", Content: `{{ stylesheet "print" }}`},
+		{Name: "unused", Content: `{{ stylesheet "dark" }}`},
+	}
+	renderer := template.NewRenderer(docs, partials, template.WithHead(`{{ inlineStylesheet "head" }}`))
+
+	tests := []struct {
+		doc      string
+		style    string
+		expected bool
+	}{
+		{"direct", "dark", true},
+		{"direct", "print", false},
+		{"partial", "dark", true},
+		{"dynamic", "print", true},
+		{"head", "head.css", true},
+		{"plain", "dark", false},
+		{"optout", "head", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.doc+" "+tt.style, func(t *testing.T) {
+			r := require.New(t)
+
+			used, err := renderer.UsesStyle(tt.doc, tt.style)
+			r.NoError(err)
+			r.Equal(tt.expected, used)
+		})
+	}
+
+	t.Run("duplicates", func(t *testing.T) {
+		r := require.New(t)
+
+		docs := []template.Template{{Name: "doc", Content: `{{ define "theme" }}{{ stylesheet "dark" }}{{ end }}{{ template "theme" }}`}}
+		partials := []template.Template{{Name: "theme", Content: `{{ stylesheet "print" }}`}}
+		renderer := template.NewRenderer(docs, partials, template.WithDuplicates(config.DuplicatesError))
+
+		// Duplicates are reported when rendering, not when looking for stylesheets
+		used, err := renderer.UsesStyle("doc", "print")
+		r.NoError(err)
+		r.True(used)
+		_, err = renderer.Render("doc", nil)
+		r.ErrorIs(err, template.ErrDuplicateDefinition)
+	})
+
+	t.Run("missing document", func(t *testing.T) {
+		_, err := renderer.UsesStyle("missing", "dark")
+		require.ErrorIs(t, err, template.ErrTemplateNotFound)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
@@ -13,27 +14,25 @@ import (
 	"github.com/esdete2/envelopr/web/views"
 )
 
-type IndexData struct {
-	Templates []TemplateInfo
-}
-
-type TemplateInfo struct {
-	Name string
-	Path string
-}
-
 func (s *Server) handleIndex() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tree, err := s.listTemplates()
-		if err != nil {
-			slog.Error("failed to list templates", slogutils.Err(err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		projects := make([]views.ProjectTree, 0, len(s.projects()))
+		for _, project := range s.projects() {
+			tree, err := listTemplates(project)
+			if err != nil {
+				slog.Error("failed to list templates", slogutils.Err(err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			projects = append(projects, views.ProjectTree{
+				Name: project.Name,
+				Tree: tree,
+			})
 		}
 
 		slog.Debug("rendering index view")
 
-		err = views.IndexView(tree).Render(r.Context(), w)
+		err := views.IndexView(projects).Render(r.Context(), w)
 		if err != nil {
 			slog.Error("failed to render index view", slogutils.Err(err))
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -45,7 +44,13 @@ func (s *Server) handleTemplate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		templatePath := chi.URLParam(r, "*")
 
-		_, err := os.ReadFile(filepath.Join(s.options.Output, templatePath))
+		outputPath, ok := s.outputPath(templatePath)
+		if !ok {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+
+		_, err := os.ReadFile(outputPath)
 		if err != nil {
 			http.Error(w, "Template not found", http.StatusNotFound)
 			return
@@ -53,7 +58,7 @@ func (s *Server) handleTemplate() http.HandlerFunc {
 
 		tmpl := views.TemplateContent{
 			Path: templatePath,
-			Name: strings.TrimSuffix(filepath.Base(templatePath), ".html"),
+			Name: strings.TrimSuffix(filepath.Base(templatePath), filepath.Ext(templatePath)),
 		}
 
 		err = views.TemplateView(tmpl).Render(r.Context(), w)
@@ -67,7 +72,13 @@ func (s *Server) handleRawTemplate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		templatePath := chi.URLParam(r, "*")
 
-		content, err := os.ReadFile(filepath.Join(s.options.Output, templatePath))
+		outputPath, ok := s.outputPath(templatePath)
+		if !ok {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+
+		content, err := os.ReadFile(outputPath)
 		if err != nil {
 			http.Error(w, "Template not found", http.StatusNotFound)
 			return
@@ -83,35 +94,40 @@ func (s *Server) handleRawTemplate() http.HandlerFunc {
 	}
 }
 
-func (s *Server) listTemplates() (views.TreeNode, error) {
+// listTemplates builds the tree of output files in the output of a project.
+// Paths are prefixed with the project name.
+func listTemplates(project ServerProject) (views.TreeNode, error) {
 	root := &views.TreeNode{
 		Name:     "/",
 		IsDir:    true,
 		Children: make([]*views.TreeNode, 0),
 	}
 
-	err := filepath.Walk(s.options.Output, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(project.Output, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
 		// Skip the root directory itself
-		if path == s.options.Output {
+		if path == project.Output {
 			return nil
 		}
 
-		// Only process directories and HTML files
-		if !info.IsDir() && filepath.Ext(path) != ".html" {
+		// Only process directories and output files
+		if !info.IsDir() && !slices.Contains(project.extensions(), filepath.Ext(path)) {
 			return nil
 		}
 
-		relPath, err := filepath.Rel(s.options.Output, path)
+		relPath, err := filepath.Rel(project.Output, path)
 		if err != nil {
 			return err
 		}
+		if project.Name != "" {
+			relPath = filepath.Join(project.Name, relPath)
+		}
 
-		// Split path into components
-		parts := strings.Split(filepath.ToSlash(relPath), "/")
+		// Split path into components, without the project prefix
+		parts := strings.Split(strings.TrimPrefix(filepath.ToSlash(relPath), project.Name+"/"), "/")
 
 		// Traverse or create nodes
 		current := root
@@ -129,10 +145,10 @@ func (s *Server) listTemplates() (views.TreeNode, error) {
 
 			if child == nil {
 				child = &views.TreeNode{
-					Name:     strings.TrimSuffix(part, ".html"),
+					Name:     strings.TrimSuffix(part, filepath.Ext(part)),
 					IsDir:    info.IsDir() || !isLast,
 					Children: make([]*views.TreeNode, 0),
-					Path:     relPath,
+					Path:     filepath.ToSlash(relPath),
 				}
 				current.Children = append(current.Children, child)
 			}
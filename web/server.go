@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -23,7 +25,27 @@ type Server struct {
 }
 
 type ServerOptions struct {
+	// Output is the output directory of a single project
 	Output string
+	// Extensions of the listed output files of a single project
+	Extensions []string
+	// Projects are served under their name as URL prefix, Output is ignored if set
+	Projects []ServerProject
+}
+
+type ServerProject struct {
+	Name   string
+	Output string
+	// Extensions of the listed output files, defaults to .html
+	Extensions []string
+}
+
+// extensions returns the file extensions of the listed output files.
+func (p ServerProject) extensions() []string {
+	if len(p.Extensions) == 0 {
+		return []string{".html"}
+	}
+	return p.Extensions
 }
 
 func NewServer(opts *ServerOptions) *Server {
@@ -55,6 +77,28 @@ func (s *Server) routes() {
 	s.router.Get("/*", s.handleTemplate())
 }
 
+// projects returns the served projects. A single project without name is served
+// at the root.
+func (s *Server) projects() []ServerProject {
+	if len(s.options.Projects) > 0 {
+		return s.options.Projects
+	}
+	return []ServerProject{{Output: s.options.Output, Extensions: s.options.Extensions}}
+}
+
+// outputPath resolves a template path of the URL to a file in a project output.
+func (s *Server) outputPath(templatePath string) (string, bool) {
+	for _, project := range s.projects() {
+		if project.Name == "" {
+			return filepath.Join(project.Output, templatePath), true
+		}
+		if rest, ok := strings.CutPrefix(templatePath, project.Name+"/"); ok {
+			return filepath.Join(project.Output, rest), true
+		}
+	}
+	return "", false
+}
+
 func (s *Server) Serve(addr string) error {
 	slog.With("address", "http://"+addr).Info("Server started")
 	//nolint: gosec
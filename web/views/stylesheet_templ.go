@@ -29,7 +29,7 @@ func stylesheet() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<style>\n        /* Global */\n        * {\n            box-sizing: border-box;\n        }\n\n        body {\n            font-family: system-ui, -apple-system, sans-serif;\n            color: #000;\n            background-color: #f1f1f1;\n            margin: 0;\n            padding: 0;\n        }\n\n        h1 {\n            font-size: 2rem;\n            font-weight: 700;\n            margin: 0 0 1rem;\n        }\n\n        a {\n            color: #000;\n            font-weight: 700;\n            text-decoration: none;\n        }\n\n        a:hover {\n            color: #70a9ff;\n        }\n\n        .c-main {\n            min-height: 100vh;\n        }\n\n        .c-main--list {\n            padding: 2rem;\n        }\n\n        .c-main--template {\n            padding: 0 2rem;\n        }\n\n        /* Template list */\n        .c-template-list {\n            padding: 2rem;\n            background-color: #fff;\n            border-radius: 12px;\n            margin: 3rem auto;\n            width: 100%;\n            max-width: 640px;\n        }\n\n        .c-template-list__list {\n            list-style: none;\n            padding: 0;\n            margin: 0;\n\n            .c-template-list__list {\n                padding-left: 1.25rem;\n            }\n        }\n\n        .c-template-list__item {\n            padding-top: 0.75rem;\n        }\n\n        .c-template-list__link {\n            display: inline-flex;\n            align-items: center;\n            gap: 0.5rem;\n        }\n\n        .c-template-list__directory-label {\n            display: flex;\n            align-items: center;\n            gap: 0.5rem;\n            font-weight: 700;\n        }\n\n        /* Template detail */\n        .c-header {\n            display: flex;\n            justify-content: space-between;\n            align-items: center;\n            height: 5rem;\n            padding: 0 1rem;\n        }\n\n        .c-header__title {\n            font-weight: 700;\n        }\n\n        .c-header__back-link {\n            display: inline-flex;\n            align-items: center;\n            gap: 0.5rem;\n        }\n\n        .c-template-preview {\n            display: flex;\n            flex-direction: column;\n            background-color: #fff;\n            padding: 2rem;\n            border-radius: 12px;\n            margin: 0 auto;\n            min-height: calc(100vh - 6rem);\n            transition: max-width 150ms ease;\n        }\n\n        .c-template-preview__iframe {\n            width: 100%;\n            min-height: 100%;\n            border: 1px solid #f1f1f1;\n            flex-grow: 1;\n        }\n\n        .c-viewport-control {\n            display: flex;\n            align-items: center;\n            gap: 0.5rem;\n        }\n\n        .c-viewport-control__button {\n            display: flex;\n            align-items: center;\n            justify-content: center;\n            width: 2.5rem;\n            height: 2.5rem;\n            color: #000;\n            background-color: #fff;\n            border-radius: 1.25rem;\n            cursor: pointer;\n            transition-property: background-color, color;\n            transition-duration: 150ms;\n            transition-timing-function: ease;\n        }\n\n        .c-viewport-control__button:hover {\n            color: #70a9ff;\n        }\n\n        .c-viewport-control__input--mobile:checked ~ .c-template-preview {\n            max-width: calc(375px + 4rem);\n        }\n\n        .c-viewport-control__input--tablet:checked ~ .c-template-preview {\n            max-width: calc(768px + 4rem);\n        }\n\n        .c-viewport-control__input--desktop:checked ~ .c-template-preview {\n            max-width: 100%;\n        }\n\n        .c-viewport-control__input--mobile:checked ~ .c-header .c-viewport-control__button--mobile,\n        .c-viewport-control__input--tablet:checked ~ .c-header .c-viewport-control__button--tablet,\n        .c-viewport-control__input--desktop:checked ~ .c-header .c-viewport-control__button--desktop {\n            color: #fff;\n            background-color: #70a9ff;\n        }\n    </style>")
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<style>\n        /* Global */\n        * {\n            box-sizing: border-box;\n        }\n\n        body {\n            font-family: system-ui, -apple-system, sans-serif;\n            color: #000;\n            background-color: #f1f1f1;\n            margin: 0;\n            padding: 0;\n        }\n\n        h1 {\n            font-size: 2rem;\n            font-weight: 700;\n            margin: 0 0 1rem;\n        }\n\n        a {\n            color: #000;\n            font-weight: 700;\n            text-decoration: none;\n        }\n\n        a:hover {\n            color: #70a9ff;\n        }\n\n        .c-main {\n            min-height: 100vh;\n        }\n\n        .c-main--list {\n            padding: 2rem;\n        }\n\n        .c-main--template {\n            padding: 0 2rem;\n        }\n\n        /* Template list */\n        .c-template-list {\n            padding: 2rem;\n            background-color: #fff;\n            border-radius: 12px;\n            margin: 3rem auto;\n            width: 100%;\n            max-width: 640px;\n        }\n\n        .c-template-list__list {\n            list-style: none;\n            padding: 0;\n            margin: 0;\n\n            .c-template-list__list {\n                padding-left: 1.25rem;\n            }\n        }\n\n        .c-template-list__item {\n            padding-top: 0.75rem;\n        }\n\n        .c-template-list__project {\n            margin: 1.5rem 0 0;\n            font-size: 1.125rem;\n            text-transform: uppercase;\n            color: #70a9ff;\n        }\n\n        .c-template-list__link {\n            display: inline-flex;\n            align-items: center;\n            gap: 0.5rem;\n        }\n\n        .c-template-list__directory-label {\n            display: flex;\n            align-items: center;\n            gap: 0.5rem;\n            font-weight: 700;\n        }\n\n        /* Template detail */\n        .c-header {\n            display: flex;\n            justify-content: space-between;\n            align-items: center;\n            height: 5rem;\n            padding: 0 1rem;\n        }\n\n        .c-header__title {\n            font-weight: 700;\n        }\n\n        .c-header__back-link {\n            display: inline-flex;\n            align-items: center;\n            gap: 0.5rem;\n        }\n\n        .c-template-preview {\n            display: flex;\n            flex-direction: column;\n            background-color: #fff;\n            padding: 2rem;\n            border-radius: 12px;\n            margin: 0 auto;\n            min-height: calc(100vh - 6rem);\n            transition: max-width 150ms ease;\n        }\n\n        .c-template-preview__iframe {\n            width: 100%;\n            min-height: 100%;\n            border: 1px solid #f1f1f1;\n            flex-grow: 1;\n        }\n\n        .c-viewport-control {\n            display: flex;\n            align-items: center;\n            gap: 0.5rem;\n        }\n\n        .c-viewport-control__button {\n            display: flex;\n            align-items: center;\n            justify-content: center;\n            width: 2.5rem;\n            height: 2.5rem;\n            color: #000;\n            background-color: #fff;\n            border-radius: 1.25rem;\n            cursor: pointer;\n            transition-property: background-color, color;\n            transition-duration: 150ms;\n            transition-timing-function: ease;\n        }\n\n        .c-viewport-control__button:hover {\n            color: #70a9ff;\n        }\n\n        .c-viewport-control__input--mobile:checked ~ .c-template-preview {\n            max-width: calc(375px + 4rem);\n        }\n\n        .c-viewport-control__input--tablet:checked ~ .c-template-preview {\n            max-width: calc(768px + 4rem);\n        }\n\n        .c-viewport-control__input--desktop:checked ~ .c-template-preview {\n            max-width: 100%;\n        }\n\n        .c-viewport-control__input--mobile:checked ~ .c-header .c-viewport-control__button--mobile,\n        .c-viewport-control__input--tablet:checked ~ .c-header .c-viewport-control__button--tablet,\n        .c-viewport-control__input--desktop:checked ~ .c-header .c-viewport-control__button--desktop {\n            color: #fff;\n            background-color: #70a9ff;\n        }\n    </style>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}